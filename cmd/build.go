@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+)
+
+// buildMetadata is how a go binary was built, as recorded in its build settings
+type buildMetadata struct {
+	Revision   string   // VCS revision of the main module, from vcs.revision
+	Time       string   // time of the VCS revision, from vcs.time
+	Modified   bool     // whether the checkout had uncommitted changes, from vcs.modified
+	GOOS       string   // target operating system
+	GOARCH     string   // target architecture
+	CGOEnabled bool     // whether cgo was enabled, from CGO_ENABLED
+	Tags       []string // build tags, from -tags
+	Trimpath   bool     // whether file system paths were removed, from -trimpath
+}
+
+// parseBuildMetadata extracts the build metadata from the build settings of a binary.
+func parseBuildMetadata(settings []debug.BuildSetting) (m buildMetadata) {
+	for _, s := range settings {
+		switch s.Key {
+		case "vcs.revision":
+			m.Revision = s.Value
+		case "vcs.time":
+			m.Time = s.Value
+		case "vcs.modified":
+			m.Modified = s.Value == "true"
+		case "GOOS":
+			m.GOOS = s.Value
+		case "GOARCH":
+			m.GOARCH = s.Value
+		case "CGO_ENABLED":
+			m.CGOEnabled = s.Value == "1"
+		case "-tags":
+			if s.Value != "" {
+				m.Tags = strings.Split(s.Value, ",")
+			}
+		case "-trimpath":
+			m.Trimpath = s.Value == "true"
+		}
+	}
+	return m
+}
+
+// String describes the build in a single line, e.g. "revision 0123abcd (modified) at 2023-01-02T03:04:05Z,
+// linux/amd64, cgo, tags netgo,osusergo, trimpath", leaving out anything that was not recorded.
+func (m buildMetadata) String() string {
+	var parts []string
+	if m.Revision != "" {
+		rev := fmt.Sprintf("revision %s", m.Revision)
+		if m.Modified {
+			rev += " (modified)"
+		}
+		if m.Time != "" {
+			rev += fmt.Sprintf(" at %s", m.Time)
+		}
+		parts = append(parts, rev)
+	}
+	if m.GOOS != "" || m.GOARCH != "" {
+		parts = append(parts, fmt.Sprintf("%s/%s", m.GOOS, m.GOARCH))
+	}
+	if m.CGOEnabled {
+		parts = append(parts, "cgo")
+	}
+	if len(m.Tags) > 0 {
+		parts = append(parts, fmt.Sprintf("tags %s", strings.Join(m.Tags, ",")))
+	}
+	if m.Trimpath {
+		parts = append(parts, "trimpath")
+	}
+	return strings.Join(parts, ", ")
+}
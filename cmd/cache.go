@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/deitch/go-sources-and-licenses/pkg"
+)
+
+const defaultPruneAge = 30 * 24 * time.Hour
+
+func cache() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the cache of results",
+		Long: `Manage the cache of what was found in each module version, which is consulted before retrieving a module,
+as module versions never change. Only modules verified against a go.sum or the checksum database are cached, and
+a result is only used for a module with the h1: hash recorded with it. A module whose hash is not known in advance
+is still retrieved to calculate its hash, but then takes the cached result, rather than being scanned again.`,
+	}
+	cmd.AddCommand(cacheLs(), cachePrune(), cacheClear())
+	return cmd
+}
+
+func cacheLs() *cobra.Command {
+	return &cobra.Command{
+		Use:   "ls",
+		Short: "List the cached results",
+		Long:  `List the cached results, one per line: the module, version, licenses, when it was last used, and the zip written from it, if any.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if resultCacheDir == "" {
+				return fmt.Errorf("no cache directory, set one with --cache-dir")
+			}
+			list, err := pkg.NewResultCache(resultCacheDir).List()
+			if err != nil {
+				return fmt.Errorf("failed to list cache %s: %v", resultCacheDir, err)
+			}
+			for _, r := range list {
+				fields := []string{r.Module, r.Version, fmt.Sprintf("%v", r.Licenses), r.Used.Format(time.RFC3339)}
+				if r.Zip != "" {
+					fields = append(fields, r.Zip)
+				}
+				fmt.Fprintln(os.Stdout, strings.Join(fields, " "))
+			}
+			return nil
+		},
+	}
+}
+
+func cachePrune() *cobra.Command {
+	var olderThan time.Duration
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove the cached results that have not been used recently",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if resultCacheDir == "" {
+				return fmt.Errorf("no cache directory, set one with --cache-dir")
+			}
+			removed, err := pkg.NewResultCache(resultCacheDir).Prune(time.Now().Add(-olderThan))
+			if err != nil {
+				return fmt.Errorf("failed to prune cache %s: %v", resultCacheDir, err)
+			}
+			log.Printf("removed %d cached results not used in %s", removed, olderThan)
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&olderThan, "older-than", defaultPruneAge, "remove results last used longer ago than this")
+	return cmd
+}
+
+func cacheClear() *cobra.Command {
+	return &cobra.Command{
+		Use:   "clear",
+		Short: "Remove every cached result",
+		Long:  `Remove every cached result. Only the result files, and the directories they leave empty, are removed, so anything else in the cache directory is kept.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if resultCacheDir == "" {
+				return fmt.Errorf("no cache directory, set one with --cache-dir")
+			}
+			if err := pkg.NewResultCache(resultCacheDir).Clear(); err != nil {
+				return fmt.Errorf("failed to clear cache %s: %v", resultCacheDir, err)
+			}
+			log.Printf("cleared cache %s", resultCacheDir)
+			return nil
+		},
+	}
+}
+
+// cachedModule returns the module from the result cache, if it has a result for the module with the given hash,
+// as if it had been retrieved and written. When writing to outpath, the zip written with the result must still
+// be there, unchanged, to be copied to the output; otherwise the module has to be retrieved again.
+func cachedModule(outpath, prefix, name, version, hash string) (p pkgInfo, ok bool) {
+	if results == nil {
+		return p, false
+	}
+	r, ok := results.Get(name, version, hash)
+	if !ok {
+		return p, false
+	}
+	p = pkgInfo{Module: name, Version: version, Licenses: r.Licenses, LicenseFiles: r.LicenseFiles, Hash: hash, Verified: true}
+	if outpath == "" {
+		return p, true
+	}
+	if r.Zip == "" {
+		return p, false
+	}
+	if sum, err := fileChecksum(r.Zip); err != nil || sum != r.Checksum {
+		log.Debugf("cached zip %s for %s is missing or changed", r.Zip, p)
+		return p, false
+	}
+	src, err := os.Open(r.Zip)
+	if err != nil {
+		return p, false
+	}
+	defer src.Close()
+	w, filename, err := getWriter(outpath, prefix, name, version)
+	if err != nil {
+		log.Warnf("failed to write cached zip for %s: %v", p, err)
+		return p, false
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		_ = w.Close()
+		log.Warnf("failed to copy cached zip for %s: %v", p, err)
+		return p, false
+	}
+	if err := w.Close(); err != nil {
+		log.Warnf("failed to copy cached zip for %s: %v", p, err)
+		return p, false
+	}
+	if p.Checksum, err = fileChecksum(filepath.Join(outpath, filename)); err != nil {
+		log.Warnf("failed to checksum output file %s: %v", filename, err)
+		return p, false
+	}
+	p.Path = filename
+	return p, true
+}
+
+// cacheModule stores the result for a module verified to have the hash p.Hash, along with the zip written
+// to outpath, if any. A result without a zip keeps the zip of an earlier result, so that it is not lost by
+// a run without --out.
+func cacheModule(outpath string, p pkgInfo) {
+	if results == nil {
+		return
+	}
+	r := pkg.Result{Module: p.Module, Version: p.Version, Hash: p.Hash, Licenses: p.Licenses, LicenseFiles: p.LicenseFiles}
+	if p.Path != "" {
+		if zipPath, err := filepath.Abs(filepath.Join(outpath, p.Path)); err == nil {
+			r.Zip, r.Checksum = zipPath, p.Checksum
+		}
+	} else if old, ok := results.Get(p.Module, p.Version, p.Hash); ok {
+		r.Zip, r.Checksum = old.Zip, old.Checksum
+	}
+	if err := results.Put(r); err != nil {
+		log.Warnf("failed to cache result for %s: %v", p, err)
+	}
+}
@@ -0,0 +1,404 @@
+package cmd
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/deitch/go-sources-and-licenses/pkg"
+)
+
+const (
+	cdxSpecVersion = "1.5"
+	cdxXMLNS       = "http://cyclonedx.org/schema/bom/1.5"
+	cdxHashSHA256  = "SHA-256"
+	cdxTypeLibrary = "library"
+	cdxTypeApp     = "application"
+)
+
+// cdxBOM is the CycloneDX document in its JSON form. The XML form is structured differently,
+// see cdxXMLBOM, and is converted from this one.
+type cdxBOM struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies"`
+}
+
+type cdxMetadata struct {
+	Timestamp  string        `json:"timestamp"`
+	Tools      cdxTools      `json:"tools"`
+	Component  *cdxComponent `json:"component,omitempty"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	BOMRef             string             `json:"bom-ref,omitempty"`
+	Type               string             `json:"type"`
+	Name               string             `json:"name"`
+	Version            string             `json:"version,omitempty"`
+	Hashes             []cdxHash          `json:"hashes,omitempty"`
+	Licenses           []cdxLicenseChoice `json:"licenses,omitempty"`
+	PURL               string             `json:"purl,omitempty"`
+	ExternalReferences []cdxExternalRef   `json:"externalReferences,omitempty"`
+	Properties         []cdxProperty      `json:"properties,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxLicenseChoice struct {
+	License cdxLicense `json:"license"`
+}
+
+type cdxLicense struct {
+	ID   string `json:"id,omitempty" xml:"id,omitempty"`
+	Name string `json:"name,omitempty" xml:"name,omitempty"`
+}
+
+type cdxExternalRef struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// writeCycloneDX writes a CycloneDX 1.5 document describing the given packages to w,
+// in either JSON or XML.
+func writeCycloneDX(w io.Writer, asXML bool, name string, pkgInfos []pkgInfo, binaries []binaryInfo) error {
+	bom, err := buildCycloneDX(name, pkgInfos, binaries)
+	if err != nil {
+		return err
+	}
+	if asXML {
+		if _, err := io.WriteString(w, xml.Header); err != nil {
+			return err
+		}
+		enc := xml.NewEncoder(w)
+		enc.Indent("", "  ")
+		if err := enc.Encode(bom.toXML()); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintln(w)
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(bom)
+}
+
+func buildCycloneDX(name string, pkgInfos []pkgInfo, binaries []binaryInfo) (*cdxBOM, error) {
+	uuid, err := newUUID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+	bom := &cdxBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  cdxSpecVersion,
+		SerialNumber: fmt.Sprintf("urn:uuid:%s", uuid),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Tools: cdxTools{
+				Components: []cdxComponent{{Type: cdxTypeApp, Name: toolName}},
+			},
+		},
+		Components:   []cdxComponent{},
+		Dependencies: []cdxDependency{},
+	}
+
+	// build properties are attached to the main module of each binary; when there is just one binary,
+	// it is the subject of the whole document, so they are attached to the metadata as well
+	buildProperties := make(map[string][]cdxProperty)
+	for _, b := range binaries {
+		buildProperties[fmt.Sprintf("%s@%s", b.Module, b.Version)] = cdxBuildProperties(b)
+	}
+	if len(binaries) == 1 {
+		bom.Metadata.Properties = cdxBuildProperties(binaries[0])
+	}
+
+	refs := make(map[string]string)
+	for _, p := range pkgInfos {
+		if _, ok := refs[p.String()]; ok {
+			continue
+		}
+		c := cdxComponent{
+			BOMRef:     p.String(),
+			Type:       cdxTypeLibrary,
+			Name:       p.Module,
+			Version:    p.Version,
+			Licenses:   cdxLicenses(p.Licenses),
+			Properties: buildProperties[p.String()],
+		}
+		if p.Version != "" {
+			c.PURL = purl(p.Module, p.Version)
+			c.BOMRef = c.PURL
+		}
+		if p.Checksum != "" {
+			c.Hashes = []cdxHash{{Alg: cdxHashSHA256, Content: p.Checksum}}
+		}
+		if p.Source != "" {
+			c.ExternalReferences = []cdxExternalRef{{Type: "distribution", URL: p.Source}}
+		}
+		if p.Hash != "" {
+			c.Properties = append(c.Properties, cdxProperty{Name: "golang:hash", Value: p.Hash})
+		}
+		if p.Replaced != "" {
+			c.Properties = append(c.Properties, cdxProperty{Name: "golang:replaces", Value: p.Replaced})
+		}
+		if p.Unavailable != "" {
+			c.Properties = append(c.Properties, cdxProperty{Name: "golang:unavailable", Value: p.Unavailable})
+		}
+		for _, b := range p.Binaries {
+			c.Properties = append(c.Properties, cdxProperty{Name: "golang:binary", Value: b})
+		}
+		refs[p.String()] = c.BOMRef
+		bom.Components = append(bom.Components, c)
+	}
+
+	// only the dependencies of the scanned modules are known, those of the modules they depend on are not;
+	// an entry with no dependsOn states that a component has none, so those modules have no entry at all
+	roots := rootPackages(pkgInfos)
+	isRoot := make(map[int]bool)
+	for _, i := range roots {
+		isRoot[i] = true
+	}
+	for i, p := range pkgInfos {
+		if len(p.Dependencies) == 0 && !isRoot[i] {
+			continue
+		}
+		dep := cdxDependency{Ref: refs[p.String()]}
+		for _, d := range p.Dependencies {
+			// we only can refer to components that are in the document
+			if ref, ok := refs[d]; ok {
+				dep.DependsOn = append(dep.DependsOn, ref)
+			}
+		}
+		bom.Dependencies = append(bom.Dependencies, dep)
+	}
+
+	// the document describes the single root, if there is one, or else the scanned target as a whole.
+	// bom-refs must be unique, so a root that describes the document is not also listed as a component.
+	if len(roots) == 1 {
+		root := refs[pkgInfos[roots[0]].String()]
+		components := bom.Components[:0]
+		for _, c := range bom.Components {
+			if c.BOMRef == root {
+				c := c
+				c.Type = cdxTypeApp
+				bom.Metadata.Component = &c
+				continue
+			}
+			components = append(components, c)
+		}
+		bom.Components = components
+	} else {
+		c := cdxComponent{BOMRef: filepath.Base(name), Type: cdxTypeApp, Name: filepath.Base(name)}
+		dep := cdxDependency{Ref: c.BOMRef}
+		for _, i := range roots {
+			dep.DependsOn = append(dep.DependsOn, refs[pkgInfos[i].String()])
+		}
+		bom.Metadata.Component = &c
+		bom.Dependencies = append(bom.Dependencies, dep)
+	}
+	return bom, nil
+}
+
+// cdxLicenses converts the license IDs found by licensecheck into CycloneDX license choices.
+func cdxLicenses(licenses []string) (choices []cdxLicenseChoice) {
+	seen := make(map[string]bool)
+	for _, l := range licenses {
+		if seen[l] {
+			continue
+		}
+		seen[l] = true
+		if l == pkg.UnknownLicenseType {
+			choices = append(choices, cdxLicenseChoice{License: cdxLicense{Name: l}})
+			continue
+		}
+		choices = append(choices, cdxLicenseChoice{License: cdxLicense{ID: l}})
+	}
+	return
+}
+
+func cdxBuildProperties(b binaryInfo) []cdxProperty {
+	props := []cdxProperty{{Name: "golang:toolchain", Value: b.GoVersion}}
+	for _, s := range b.Settings {
+		props = append(props, cdxProperty{Name: fmt.Sprintf("golang:build:%s", s.Key), Value: s.Value})
+	}
+	return props
+}
+
+// the XML form of the document. encoding/xml does not omit empty wrapper elements given as a>b,
+// so every list is wrapped explicitly.
+
+type cdxXMLBOM struct {
+	XMLName      xml.Name            `xml:"bom"`
+	XMLNS        string              `xml:"xmlns,attr"`
+	SerialNumber string              `xml:"serialNumber,attr"`
+	Version      int                 `xml:"version,attr"`
+	Metadata     cdxXMLMetadata      `xml:"metadata"`
+	Components   cdxXMLComponents    `xml:"components"`
+	Dependencies *cdxXMLDependencies `xml:"dependencies,omitempty"`
+}
+
+type cdxXMLMetadata struct {
+	Timestamp  string            `xml:"timestamp"`
+	Tools      cdxXMLTools       `xml:"tools"`
+	Component  *cdxXMLComponent  `xml:"component,omitempty"`
+	Properties *cdxXMLProperties `xml:"properties,omitempty"`
+}
+
+type cdxXMLTools struct {
+	Components cdxXMLComponents `xml:"components"`
+}
+
+type cdxXMLComponents struct {
+	Component []cdxXMLComponent `xml:"component"`
+}
+
+type cdxXMLComponent struct {
+	BOMRef             string            `xml:"bom-ref,attr,omitempty"`
+	Type               string            `xml:"type,attr"`
+	Name               string            `xml:"name"`
+	Version            string            `xml:"version,omitempty"`
+	Hashes             *cdxXMLHashes     `xml:"hashes,omitempty"`
+	Licenses           *cdxXMLLicenses   `xml:"licenses,omitempty"`
+	PURL               string            `xml:"purl,omitempty"`
+	ExternalReferences *cdxXMLExtRefs    `xml:"externalReferences,omitempty"`
+	Properties         *cdxXMLProperties `xml:"properties,omitempty"`
+}
+
+type cdxXMLHashes struct {
+	Hash []cdxXMLHash `xml:"hash"`
+}
+
+type cdxXMLHash struct {
+	Alg     string `xml:"alg,attr"`
+	Content string `xml:",chardata"`
+}
+
+type cdxXMLLicenses struct {
+	License []cdxLicense `xml:"license"`
+}
+
+type cdxXMLExtRefs struct {
+	Reference []cdxXMLExtRef `xml:"reference"`
+}
+
+type cdxXMLExtRef struct {
+	Type string `xml:"type,attr"`
+	URL  string `xml:"url"`
+}
+
+type cdxXMLProperties struct {
+	Property []cdxXMLProperty `xml:"property"`
+}
+
+type cdxXMLProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:",chardata"`
+}
+
+type cdxXMLDependencies struct {
+	Dependency []cdxXMLDependency `xml:"dependency"`
+}
+
+type cdxXMLDependency struct {
+	Ref       string             `xml:"ref,attr"`
+	DependsOn []cdxXMLDependency `xml:"dependency,omitempty"`
+}
+
+func (b *cdxBOM) toXML() cdxXMLBOM {
+	x := cdxXMLBOM{
+		XMLNS:        cdxXMLNS,
+		SerialNumber: b.SerialNumber,
+		Version:      b.Version,
+		Metadata: cdxXMLMetadata{
+			Timestamp:  b.Metadata.Timestamp,
+			Properties: cdxPropertiesToXML(b.Metadata.Properties),
+		},
+	}
+	for _, c := range b.Metadata.Tools.Components {
+		x.Metadata.Tools.Components.Component = append(x.Metadata.Tools.Components.Component, c.toXML())
+	}
+	if b.Metadata.Component != nil {
+		c := b.Metadata.Component.toXML()
+		x.Metadata.Component = &c
+	}
+	for _, c := range b.Components {
+		x.Components.Component = append(x.Components.Component, c.toXML())
+	}
+	if len(b.Dependencies) > 0 {
+		x.Dependencies = &cdxXMLDependencies{}
+	}
+	for _, d := range b.Dependencies {
+		xd := cdxXMLDependency{Ref: d.Ref}
+		for _, ref := range d.DependsOn {
+			xd.DependsOn = append(xd.DependsOn, cdxXMLDependency{Ref: ref})
+		}
+		x.Dependencies.Dependency = append(x.Dependencies.Dependency, xd)
+	}
+	return x
+}
+
+func (c cdxComponent) toXML() cdxXMLComponent {
+	x := cdxXMLComponent{
+		BOMRef:     c.BOMRef,
+		Type:       c.Type,
+		Name:       c.Name,
+		Version:    c.Version,
+		PURL:       c.PURL,
+		Properties: cdxPropertiesToXML(c.Properties),
+	}
+	if len(c.Hashes) > 0 {
+		x.Hashes = &cdxXMLHashes{}
+		for _, h := range c.Hashes {
+			x.Hashes.Hash = append(x.Hashes.Hash, cdxXMLHash{Alg: h.Alg, Content: h.Content})
+		}
+	}
+	if len(c.Licenses) > 0 {
+		x.Licenses = &cdxXMLLicenses{}
+		for _, l := range c.Licenses {
+			x.Licenses.License = append(x.Licenses.License, l.License)
+		}
+	}
+	if len(c.ExternalReferences) > 0 {
+		x.ExternalReferences = &cdxXMLExtRefs{}
+		for _, r := range c.ExternalReferences {
+			x.ExternalReferences.Reference = append(x.ExternalReferences.Reference, cdxXMLExtRef{Type: r.Type, URL: r.URL})
+		}
+	}
+	return x
+}
+
+func cdxPropertiesToXML(props []cdxProperty) *cdxXMLProperties {
+	if len(props) == 0 {
+		return nil
+	}
+	x := &cdxXMLProperties{}
+	for _, p := range props {
+		x.Property = append(x.Property, cdxXMLProperty{Name: p.Name, Value: p.Value})
+	}
+	return x
+}
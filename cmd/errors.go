@@ -1,7 +1,24 @@
 package cmd
 
+import "fmt"
+
 type ErrNoModFile struct{}
 
 func (e ErrNoModFile) Error() string {
 	return "no go.mod file found"
 }
+
+// ErrScanBinary is a failure to scan a go binary found in a directory, archive or image, as opposed to a file
+// that is not a go binary, which is skipped.
+type ErrScanBinary struct {
+	Path string
+	Err  error
+}
+
+func (e ErrScanBinary) Error() string {
+	return fmt.Sprintf("failed to scan binary %s: %v", e.Path, e.Err)
+}
+
+func (e ErrScanBinary) Unwrap() error {
+	return e.Err
+}
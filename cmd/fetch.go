@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// fetcher retrieves and writes the modules for the current command, as many at once as set by --concurrency
+var fetcher = newModuleFetcher(context.Background(), 1)
+
+// moduleFetcher retrieves and writes modules from the proxy in the background, up to a limited number at once.
+// Each module@version is retrieved only once, however many times it is asked for, including while it still is
+// in flight. The results are collected by the caller, so that the report is in the same order however long
+// each module takes; the existing map is only ever touched by the caller.
+type moduleFetcher struct {
+	ctx     context.Context
+	sem     chan struct{}
+	mu      sync.Mutex
+	fetches map[fetchKey]*moduleFetch
+}
+
+// fetchKey identifies a retrieval. It includes the hash the module is expected to have, so that one verified
+// against a go.sum is never taken from a retrieval that was not.
+type fetchKey struct {
+	module   string
+	expected string
+}
+
+// moduleFetch is the retrieval of a single module@version, which may still be in flight
+type moduleFetch struct {
+	done chan struct{}
+	info pkgInfo
+	err  error
+}
+
+// newModuleFetcher creates a moduleFetcher whose retrievals are abandoned once ctx is done.
+func newModuleFetcher(ctx context.Context, concurrency int) *moduleFetcher {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &moduleFetcher{
+		ctx:     ctx,
+		sem:     make(chan struct{}, concurrency),
+		fetches: make(map[fetchKey]*moduleFetch),
+	}
+}
+
+// start retrieves and writes the module name@version in the background, verified against sums as with
+// getAndWriteModule, unless it already was started.
+func (f *moduleFetcher) start(outpath, prefix, name, version string, sums map[string]string) *moduleFetch {
+	mod := fmt.Sprintf("%s@%s", name, version)
+	key := fetchKey{module: mod, expected: sums[mod]}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if fetch, ok := f.fetches[key]; ok {
+		return fetch
+	}
+	fetch := &moduleFetch{done: make(chan struct{})}
+	f.fetches[key] = fetch
+	go func() {
+		defer close(fetch.done)
+		select {
+		case f.sem <- struct{}{}:
+		case <-f.ctx.Done():
+			fetch.err = f.ctx.Err()
+			return
+		}
+		defer func() { <-f.sem }()
+		fetch.info, fetch.err = getAndWriteModule(f.ctx, outpath, prefix, name, version, sums)
+	}()
+	return fetch
+}
+
+// wait returns the module once it has been retrieved and written.
+func (m *moduleFetch) wait() (pkgInfo, error) {
+	<-m.done
+	return m.info, m.err
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"text/template"
+)
+
+const (
+	outputFormatText          = "text"
+	outputFormatSPDXJSON      = "spdx-json"
+	outputFormatCycloneDXJSON = "cyclonedx-json"
+	outputFormatCycloneDXXML  = "cyclonedx-xml"
+)
+
+var outputFormats = []string{outputFormatText, outputFormatSPDXJSON, outputFormatCycloneDXJSON, outputFormatCycloneDXXML}
+
+func isValidOutputFormat(format string) bool {
+	for _, f := range outputFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// writeOutput writes the report for the given packages, and the binaries in which they were found, if any,
+// to w in the requested format. name is the name of the scanned target, used to name documents for those
+// formats that need it.
+func writeOutput(w io.Writer, format, name string, tmpl *template.Template, pkgInfos []pkgInfo, binaries []binaryInfo) error {
+	switch format {
+	case outputFormatText:
+		for _, p := range pkgInfos {
+			if err := tmpl.Execute(w, p); err != nil {
+				return fmt.Errorf("failed to execute template for %s: %v", p, err)
+			}
+			fmt.Fprintln(w)
+		}
+	case outputFormatSPDXJSON:
+		return writeSPDX(w, name, pkgInfos)
+	case outputFormatCycloneDXJSON, outputFormatCycloneDXXML:
+		return writeCycloneDX(w, format == outputFormatCycloneDXXML, name, pkgInfos, binaries)
+	default:
+		return fmt.Errorf("unknown output format %s", format)
+	}
+	return nil
+}
+
+// rootPackages returns the indexes of packages on which no other package depends.
+func rootPackages(pkgInfos []pkgInfo) []int {
+	depended := make(map[string]bool)
+	for _, p := range pkgInfos {
+		for _, d := range p.Dependencies {
+			depended[d] = true
+		}
+	}
+	var roots []int
+	for i, p := range pkgInfos {
+		if !depended[p.String()] {
+			roots = append(roots, i)
+		}
+	}
+	return roots
+}
@@ -1,20 +1,41 @@
 package cmd
 
 import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+
+	"github.com/deitch/go-sources-and-licenses/pkg"
 )
 
 const (
-	defaultProxyURL = "https://proxy.golang.org"
+	defaultProxyURL = "https://proxy.golang.org,direct"
 )
 
 var (
 	proxyURL string
+	// sumDB is the checksum database against which to verify modules that are not in a go.sum, if any
+	sumDB *pkg.SumDB
+	// resultCacheDir is the directory of the result cache, and results the cache itself, unless disabled
+	resultCacheDir string
+	results        *pkg.ResultCache
 )
 
 func New() *cobra.Command {
-	var debug bool
+	var (
+		debug                 bool
+		sumDBLocation, sumKey string
+		httpTimeout           time.Duration
+		httpRetries           int
+		proxyToken            string
+		proxyHeaders          []string
+		noCache               bool
+	)
 	cmd := &cobra.Command{
 		Use:               "license-reader",
 		DisableAutoGenTag: true,
@@ -23,13 +44,64 @@ func New() *cobra.Command {
 			if debug {
 				logrus.SetLevel(logrus.DebugLevel)
 			}
+			// like the go command, use GOPROXY from the environment, unless explicitly overridden
+			if !cmd.Flags().Changed("proxy") {
+				if env := os.Getenv("GOPROXY"); env != "" {
+					proxyURL = env
+				}
+			}
+			if httpRetries < 0 {
+				return fmt.Errorf("--http-retries cannot be negative")
+			}
+			pkg.SetHTTPOptions(pkg.HTTPOptions{Timeout: httpTimeout, Retries: httpRetries})
+			header := make(http.Header)
+			for _, h := range proxyHeaders {
+				name, value, ok := strings.Cut(h, ":")
+				if !ok || strings.TrimSpace(name) == "" {
+					// the header may hold a credential, so it is left out of the error
+					return fmt.Errorf("invalid --proxy-header, must be Name: value")
+				}
+				header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+			}
+			if proxyToken != "" {
+				header.Set("Authorization", "Bearer "+proxyToken)
+			}
+			if err := pkg.ConfigureAuth(pkg.AuthOptions{Proxies: proxyURL, ProxyHeader: header}); err != nil {
+				return fmt.Errorf("failed to configure authentication: %v", err)
+			}
+			if sumDBLocation != "" {
+				db, err := pkg.NewSumDB(cmd.Context(), sumDBLocation, sumKey)
+				if err != nil {
+					return fmt.Errorf("failed to open checksum database: %v", err)
+				}
+				sumDB = db
+			}
+			if resultCacheDir == "" {
+				if dir, err := pkg.DefaultResultCacheDir(); err == nil {
+					resultCacheDir = dir
+				} else {
+					logrus.Debugf("no result cache: %v", err)
+				}
+			}
+			if !noCache && resultCacheDir != "" {
+				results = pkg.NewResultCache(resultCacheDir)
+			}
 			return nil
 		},
 	}
 
 	cmd.AddCommand(sources())
+	cmd.AddCommand(cache())
 
-	cmd.PersistentFlags().StringVarP(&proxyURL, "proxy", "p", defaultProxyURL, "proxy URL to use")
+	cmd.PersistentFlags().StringVarP(&proxyURL, "proxy", "p", defaultProxyURL, "proxy list to use, in the same format as GOPROXY, including \"direct\" and \"off\". Defaults to the GOPROXY environment variable, if set")
+	cmd.PersistentFlags().StringVar(&sumDBLocation, "sumdb", "", "checksum database with which to verify modules that are not listed in a go.sum, either a URL or a local directory mirroring its lookup and tiles, e.g. https://sum.golang.org. Modules matching GONOSUMDB or GOPRIVATE are not verified")
+	cmd.PersistentFlags().StringVar(&sumKey, "sumdb-key", "", "verifier key of the checksum database given by --sumdb. Defaults to the key in GOSUMDB, if set, else the key of sum.golang.org")
+	cmd.PersistentFlags().DurationVar(&httpTimeout, "http-timeout", pkg.DefaultHTTPTimeout, "time allowed for each HTTP request to a proxy or checksum database, including the download; 0 for no limit")
+	cmd.PersistentFlags().IntVar(&httpRetries, "http-retries", pkg.DefaultHTTPRetries, "times to retry an HTTP request after a network error, or a 429 or 5xx response, with exponential backoff")
+	cmd.PersistentFlags().StringVar(&proxyToken, "proxy-token", "", "bearer token to send to the proxies in the proxy list. Credentials from GOAUTH, by default from NETRC or ~/.netrc, are used as well, as by the go command")
+	cmd.PersistentFlags().StringArrayVar(&proxyHeaders, "proxy-header", nil, "additional header to send to the proxies in the proxy list, as Name: value; may be repeated")
+	cmd.PersistentFlags().StringVar(&resultCacheDir, "cache-dir", "", "directory of the cache of results for module versions already scanned. Defaults to go-sources-and-licenses in the user cache directory")
+	cmd.PersistentFlags().BoolVar(&noCache, "no-cache", false, "neither use nor store results in the result cache")
 	cmd.PersistentFlags().BoolVar(&debug, "debug", false, "enable debug logging")
 	return cmd
 }
@@ -3,7 +3,10 @@ package cmd
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"debug/buildinfo"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -18,30 +21,58 @@ import (
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"golang.org/x/mod/module"
 
 	"github.com/deitch/go-sources-and-licenses/pkg"
 )
 
 const (
 	modFile         = "go.mod"
+	sumFile         = "go.sum"
 	defaultTemplate = `{{.Module}} {{.Version}} {{.Licenses}} {{.Path}}`
 )
 
 type pkgInfo struct {
-	Module   string
-	Version  string
-	Licenses []string
-	Path     string
+	Module       string
+	Version      string
+	Licenses     []string
+	Path         string
+	Checksum     string            // sha256 of the written zip file, if one was written
+	Source       string            // location from which the module was downloaded, if any
+	Dependencies []string          // module@version of each direct dependency
+	Hash         string            // h1: hash of the module contents, if it was retrieved
+	Verified     bool              // whether Hash was verified against a go.sum or checksum database
+	Replaced     string            // module@version of the requirement that this module replaced, if any
+	Binaries     []string          // paths of the scanned binaries into which this module was built, if any
+	Build        buildMetadata     // how the binary was built, if this is the main module of a scanned binary
+	LicenseFiles map[string]string // sha256 of each license file found, keyed by its path in the zip
+	Unavailable  string            // why the source of the module could not be retrieved, if it could not
 }
 
 func (p pkgInfo) String() string {
 	return fmt.Sprintf("%s@%s", p.Module, p.Version)
 }
 
+// binaryInfo describes a go binary that was scanned
+type binaryInfo struct {
+	Path      string               // path to the binary that was scanned
+	Module    string               // path of the main module
+	Version   string               // version of the main module, as recorded or calculated from build flags
+	GoVersion string               // version of the go toolchain used to build the binary
+	Settings  []debug.BuildSetting // build settings recorded in the binary
+	Modules   []string             // module@version of each module built into the binary that was reported
+	Build     buildMetadata        // how the binary was built, from the build settings
+}
+
 func sources() *cobra.Command {
 	var (
-		version, outpath, format, prefix string
-		find, module, src, binary        bool
+		version, outpath, format, prefix, outputFormat string
+		find, module, src, binary, image, buildList    bool
+		packages, tags                                 []string
+		goos, goarch                                   string
+		excludeTests, vendor, toolchainSource          bool
+		archiveMaxDepth, concurrency                   int
+		archiveMaxSize                                 int64
 	)
 
 	cmd := &cobra.Command{
@@ -50,8 +81,9 @@ func sources() *cobra.Command {
 		Short:   "Download source",
 		Args:    cobra.ExactArgs(1),
 		Long: `Download sources for a golang package or directory.
-		There is to be a single argument, one of a module name, the path to a source directory, or the path to a binary.
-		The usage of that argument is determined by the arguments --module, --src and --binary.
+		There is to be a single argument, one of a module name, the path to a source directory, the path to a binary,
+		or the path to a container image.
+		The usage of that argument is determined by the arguments --module, --src, --binary and --image.
 
 		Examples:
 		
@@ -78,6 +110,12 @@ func sources() *cobra.Command {
 
 		get sources for any binary found in the tree under a path (--find)
 			sources -o /tmp/output.zip -b --find /usr/local/bin
+
+		get sources for any binary in a release archive, or in archives found in the tree under a path (--find)
+			sources -o /tmp/output.zip -b /tmp/release.tar.gz
+
+		get sources for every go binary in a container image, saved with docker save or as an OCI image layout
+			sources -o /tmp/output.zip -i /tmp/image.tar
 		`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			var (
@@ -85,41 +123,117 @@ func sources() *cobra.Command {
 				err        error
 				existing   = make(map[string]bool)
 				pkgInfos   []pkgInfo
+				binaries   []binaryInfo
 				moduleName string
 			)
 
 			target := args[0]
+			ctx := cmd.Context()
 
 			tmpl, err := template.New("sources").Parse(format)
 			if err != nil {
 				return fmt.Errorf("failed to parse template: %v", err)
 			}
+			if !isValidOutputFormat(outputFormat) {
+				return fmt.Errorf("unknown output format %s, must be one of: %s", outputFormat, strings.Join(outputFormats, ", "))
+			}
+			if len(packages) > 0 && !src {
+				return fmt.Errorf("--packages requires --src")
+			}
+			if vendor && (!src || buildList) {
+				return fmt.Errorf("--vendor requires --src, and cannot be used with --build-list")
+			}
+			if concurrency < 1 {
+				return fmt.Errorf("--concurrency must be at least 1")
+			}
+			fetcher = newModuleFetcher(ctx, concurrency)
+			opts := sourceOptions{buildList: buildList}
+			archiveOpts := pkg.ArchiveOptions{MaxDepth: archiveMaxDepth, MaxSize: archiveMaxSize}
+			// scanBinary adds the binary at path, found in a directory, archive or image, if it is a go binary
+			scanBinary := func(path string, r io.ReaderAt) error {
+				// unfortunately, go's buildinfo.Read() does not distinguish between errors reading the file,
+				// and files that are not go binaries, so any file it cannot read is skipped
+				info, err := buildinfo.Read(r)
+				if err != nil {
+					log.Debugf("skipping %s, which is not a go binary: %v", path, err)
+					return nil
+				}
+				added, bin, err := writeModuleFromBinary(ctx, outpath, prefix, info, existing, toolchainSource)
+				if err != nil {
+					return ErrScanBinary{Path: path, Err: err}
+				}
+				log.Printf("scanned binary at %s", path)
+				for _, a := range added {
+					existing[a.String()] = true
+				}
+				bin.Path = path
+				binaries = append(binaries, bin)
+				pkgInfos = append(pkgInfos, added...)
+				return nil
+			}
+			pkgOpts := pkg.PackageOptions{GOOS: goos, GOARCH: goarch, Tags: tags, Tests: !excludeTests}
 
 			switch {
 			case (cmd.CalledAs() == "sources" || cmd.CalledAs() == "source") && outpath == "":
 				return fmt.Errorf("must specify output path")
-			case (!module && !src && !binary) || (module && src) || (module && binary) || (src && binary) || (module && src && binary):
-				return fmt.Errorf("must specify exactly one of --binary, --module or --src")
+			case countTrue(module, src, binary, image) != 1:
+				return fmt.Errorf("must specify exactly one of --binary, --image, --module or --src")
 			case module:
 				moduleName = target
-				fsys, err = pkg.GetModule(moduleName, version, proxyURL, false)
+				if version == "" {
+					if version, err = pkg.LatestVersion(ctx, moduleName, proxyURL); err != nil {
+						return fmt.Errorf("failed to get latest version of module %s: %v", moduleName, err)
+					}
+				}
+				fsys, err = pkg.GetModule(ctx, moduleName, version, proxyURL, false)
 				if err != nil {
 					return fmt.Errorf("failed to get module %s: %v", moduleName, err)
 				}
+				defer closeModule(fsys)
 				log.Printf("writing module %s version %s from direct package", moduleName, version)
-				added, err := writeModuleFromSource(outpath, prefix, moduleName, version, fsys, existing)
+				added, err := writeModuleFromSource(ctx, outpath, prefix, moduleName, version, fsys, existing, opts)
 				if err != nil {
 					return err
 				}
+				if len(added) > 0 {
+					added[0].Source = downloadLocation(moduleName, version)
+				}
 				pkgInfos = append(pkgInfos, added...)
 			case src && !find:
+				if len(packages) > 0 {
+					if opts.modules, err = pkg.PackageModules(ctx, target, packages, pkgOpts); err != nil {
+						return fmt.Errorf("failed to resolve packages in %s: %v", target, err)
+					}
+				}
+				var ws *workspace
+				if !vendor {
+					if ws, err = findWorkspace(target); err != nil {
+						return fmt.Errorf("failed to read workspace for %s: %v", target, err)
+					}
+				}
+				if ws != nil {
+					log.Printf("writing workspace %s", ws.dir)
+					added, err := writeWorkspace(ctx, outpath, prefix, version, ws, existing, opts)
+					if err != nil {
+						return err
+					}
+					pkgInfos = append(pkgInfos, added...)
+					break
+				}
 				// get version
 				if version == "" {
 					version = GoVersion(target)
 				}
 				fsys = os.DirFS(target)
-				log.Printf("writing module from source directory %s", target)
-				added, err := writeModuleFromSource(outpath, prefix, "", version, fsys, existing)
+				opts.dir = target
+				var added []pkgInfo
+				if vendor {
+					log.Printf("writing module and vendored modules from source directory %s", target)
+					added, err = writeModuleFromVendor(outpath, prefix, version, fsys, existing, opts)
+				} else {
+					log.Printf("writing module from source directory %s", target)
+					added, err = writeModuleFromSource(ctx, outpath, prefix, "", version, fsys, existing, opts)
+				}
 				if err != nil {
 					return err
 				}
@@ -127,7 +241,28 @@ func sources() *cobra.Command {
 			case src && find:
 				log.Printf("find for source enabled based at %s", target)
 				fsys = os.DirFS(target)
-				err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+				// modules in a workspace are written together, before any others
+				var workspaces []*workspace
+				if !vendor {
+					if workspaces, err = findWorkspaces(target); err != nil {
+						return err
+					}
+				}
+				for _, ws := range workspaces {
+					wsOpts := opts
+					if len(packages) > 0 {
+						if wsOpts.modules, err = pkg.PackageModules(ctx, ws.dir, packages, pkgOpts); err != nil {
+							return fmt.Errorf("failed to resolve packages in %s: %v", ws.dir, err)
+						}
+					}
+					log.Printf("writing workspace %s", ws.dir)
+					added, err := writeWorkspace(ctx, outpath, prefix, version, ws, existing, wsOpts)
+					if err != nil {
+						return err
+					}
+					pkgInfos = append(pkgInfos, added...)
+				}
+				err = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
 					if err != nil && !errors.Is(err, io.EOF) {
 						return fmt.Errorf("failed to walk %s: %v", path, err)
 					}
@@ -136,6 +271,11 @@ func sources() *cobra.Command {
 						return nil
 					}
 					dir := filepath.Dir(path)
+					for _, ws := range workspaces {
+						if ws.contains(filepath.Join(target, dir)) {
+							return nil
+						}
+					}
 					if version == "" {
 						version = GoVersion(filepath.Join(target, dir))
 					}
@@ -143,8 +283,21 @@ func sources() *cobra.Command {
 					if err != nil {
 						return fmt.Errorf("failed to get subdirectory %s: %v", path, err)
 					}
-					log.Printf("writing module from directory %s", dir)
-					added, err := writeModuleFromSource(outpath, prefix, "", version, sub, existing)
+					opts := opts
+					opts.dir = filepath.Join(target, dir)
+					if len(packages) > 0 {
+						if opts.modules, err = pkg.PackageModules(ctx, opts.dir, packages, pkgOpts); err != nil {
+							return fmt.Errorf("failed to resolve packages in %s: %v", dir, err)
+						}
+					}
+					var added []pkgInfo
+					if vendor {
+						log.Printf("writing module and vendored modules from directory %s", dir)
+						added, err = writeModuleFromVendor(outpath, prefix, version, sub, existing, opts)
+					} else {
+						log.Printf("writing module from directory %s", dir)
+						added, err = writeModuleFromSource(ctx, outpath, prefix, "", version, sub, existing, opts)
+					}
 					if err != nil {
 						return err
 					}
@@ -164,10 +317,30 @@ func sources() *cobra.Command {
 					return fmt.Errorf("failed to open %s: %v", target, err)
 				}
 				defer f.Close()
-				added, err := writeModuleFromBinary(outpath, prefix, f, existing)
+				if pkg.IsArchive(f) {
+					fi, err := f.Stat()
+					if err != nil {
+						return fmt.Errorf("failed to get info for %s: %v", target, err)
+					}
+					// as with binaries found in a directory, a file that only looks like an archive is skipped
+					if err := pkg.ScanArchive(target, f, fi.Size(), archiveOpts, scanBinary); err != nil {
+						if errors.As(err, &ErrScanBinary{}) {
+							return err
+						}
+						log.Warnf("skipping %s, which is not a readable archive: %v", target, err)
+					}
+					break
+				}
+				info, err := buildinfo.Read(f)
+				if err != nil {
+					return fmt.Errorf("failed to read build info of %s: %v", target, err)
+				}
+				added, bin, err := writeModuleFromBinary(ctx, outpath, prefix, info, existing, toolchainSource)
 				if err != nil {
 					return err
 				}
+				bin.Path = target
+				binaries = append(binaries, bin)
 				pkgInfos = append(pkgInfos, added...)
 			case binary && find:
 				log.Printf("find for go binaries enabled based at %s", target)
@@ -199,39 +372,53 @@ func sources() *cobra.Command {
 					if !ok {
 						return fmt.Errorf("failed to convert %s to io.ReaderAt", path)
 					}
-					added, err := writeModuleFromBinary(outpath, prefix, fra, existing)
-					// unfortunately, go's buildinfo.Read() does not distinguish between errors opening the file,
-					// and errors of the wrong file type. Oh well.
-					if err != nil {
+					// release archives are searched for the binaries within them; one that cannot be read is skipped,
+					// as non-go binaries are, rather than ending the search
+					if pkg.IsArchive(fra) {
+						if err := pkg.ScanArchive(path, fra, fi.Size(), archiveOpts, scanBinary); err != nil {
+							if errors.As(err, &ErrScanBinary{}) {
+								return err
+							}
+							log.Warnf("skipping %s, which is not a readable archive: %v", path, err)
+						}
 						return nil
 					}
-					log.Printf("scanned binary at %s", path)
-					for _, a := range added {
-						existing[a.String()] = true
-					}
-					pkgInfos = append(pkgInfos, added...)
-					return nil
+					return scanBinary(path, fra)
 				})
 				if err != nil {
 					return fmt.Errorf("failed to walk directory %s: %v", target, err)
 				}
+			case image:
+				log.Printf("scanning go binaries in image %s", target)
+				if err := pkg.ScanImage(target, archiveMaxSize, scanBinary); err != nil {
+					return err
+				}
 			}
+			annotateBinaries(pkgInfos, binaries)
 
-			for _, p := range pkgInfos {
-				tmpl.Execute(os.Stdout, p)
-				fmt.Println()
-			}
-
-			return nil
+			return writeOutput(os.Stdout, outputFormat, target, tmpl, pkgInfos, binaries)
 		},
 	}
 	cmd.Flags().BoolVarP(&module, "module", "m", false, "argument is name of module to find and check from the Internet")
 	cmd.Flags().BoolVarP(&src, "src", "s", false, "argument is path to a golang module source directory to check. If provided with `--find`, will look for all directories in the tree, finding those with `go.mod` to treat as a module source and scan it.")
-	cmd.Flags().BoolVarP(&binary, "binary", "b", false, "argument is a binary to check. If provided with `--find`, will look for all files in the tree, to see if it is a go binary and scan it.")
+	cmd.Flags().BoolVarP(&binary, "binary", "b", false, "argument is a binary to check. If provided with `--find`, will look for all files in the tree, to see if it is a go binary and scan it. Zip, tar and tar.gz archives are searched for the binaries within them.")
+	cmd.Flags().BoolVarP(&image, "image", "i", false, "argument is a container image, either an OCI image layout directory or a tar archive of one, as written by `docker save`. The layers are applied in order, and every go binary in the resulting filesystem is scanned.")
 	cmd.Flags().StringVarP(&version, "version", "v", "", "version of a module to check; useful only with `--module`, no meaning otherwise. Leave blank to get latest.")
 	cmd.Flags().BoolVarP(&find, "find", "f", false, "find recursively within the provided directory; useful only with --src and --binary, ignored otherwise")
 	cmd.Flags().StringVarP(&outpath, "out", "o", "", "output directory for the zip files; useful only with `sources` command, ignored otherwise")
-	cmd.Flags().StringVar(&format, "template", defaultTemplate, "output template to use. Available fields are: .Module, .Version, .Licenses, .Path")
+	cmd.Flags().StringVar(&format, "template", defaultTemplate, "output template to use with the text output format. Available fields are: .Module, .Version, .Licenses, .Path, .Checksum, .Source, .Dependencies, .Hash, .Verified, .Replaced, .Binaries, .Build, .LicenseFiles, .Unavailable, and the build metadata of the main module of a binary as .Build.Revision, .Build.Time, .Build.Modified, .Build.GOOS, .Build.GOARCH, .Build.CGOEnabled, .Build.Tags, .Build.Trimpath")
+	cmd.Flags().StringVar(&outputFormat, "output-format", outputFormatText, fmt.Sprintf("format of the report written to stdout, one of: %s", strings.Join(outputFormats, ", ")))
+	cmd.Flags().BoolVar(&buildList, "build-list", false, "report the full build list of each module, as selected by minimal version selection from the go.mod of every dependency, rather than only the requirements listed in its go.mod; useful only with --module and --src")
+	cmd.Flags().StringSliceVar(&packages, "packages", nil, "only report modules that provide packages imported by these packages of the module, e.g. ./cmd/..., as resolved by the go command; useful only with --src")
+	cmd.Flags().StringVar(&goos, "goos", "", "target operating system for resolving --packages, defaults to that of the go command")
+	cmd.Flags().StringVar(&goarch, "goarch", "", "target architecture for resolving --packages, defaults to that of the go command")
+	cmd.Flags().StringSliceVar(&tags, "tags", nil, "additional build tags for resolving --packages")
+	cmd.Flags().BoolVar(&excludeTests, "exclude-tests", false, "do not include the dependencies of tests when resolving --packages")
+	cmd.Flags().BoolVar(&vendor, "vendor", false, "take the dependencies of each module from its vendor directory, as listed in vendor/modules.txt, without any network access; useful only with --src")
+	cmd.Flags().BoolVar(&toolchainSource, "toolchain-source", false, "also write the source of the go standard library and runtime linked into each binary, from the local GOROOT if it is the same version, else from the golang.org/toolchain module on the proxy; useful only with `sources` and --binary")
+	cmd.Flags().IntVar(&archiveMaxDepth, "archive-max-depth", pkg.DefaultArchiveMaxDepth, "how many archives deep to look for binaries, such as a zip within a tar.gz; useful only with --binary")
+	cmd.Flags().Int64Var(&archiveMaxSize, "archive-max-size", pkg.DefaultArchiveMaxSize, "size in bytes of the largest archive member to read, uncompressed; larger ones are skipped. Also the size of the largest file read from an image. Useful only with --binary and --image")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 1, "how many modules to retrieve, scan and write at once")
 	cmd.Flags().StringVar(&prefix, "prefix", "", "prefix to prepend to each output filename")
 	return cmd
 }
@@ -278,7 +465,15 @@ func getWriter(outpath, prefix, module, version string) (io.WriteCloser, string,
 	return w, filename, nil
 }
 
-func writeModuleFromSource(outpath, prefix, name, version string, fsys fs.FS, existing map[string]bool) (pkgInfos []pkgInfo, err error) {
+// sourceOptions control which requirements of a module in source form are written
+type sourceOptions struct {
+	buildList bool            // use the full build list, rather than only the requirements listed in the go.mod
+	modules   map[string]bool // if not nil, only the requirements with these module paths, which provide packages
+	dir       string          // directory of the module on disk, against which local replacements are resolved
+}
+
+// writeModuleFromSource writes the module in fsys and each of its requirements, as selected by opts.
+func writeModuleFromSource(ctx context.Context, outpath, prefix, name, version string, fsys fs.FS, existing map[string]bool, opts sourceOptions) (pkgInfos []pkgInfo, err error) {
 	info, err := writeModule(outpath, prefix, name, version, fsys)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get package %s@%s: %w", name, version, err)
@@ -286,53 +481,140 @@ func writeModuleFromSource(outpath, prefix, name, version string, fsys fs.FS, ex
 	pkgInfos = append(pkgInfos, info)
 	existing[info.String()] = true
 
-	f, err := fsys.Open(modFile)
+	sums, err := readSums(fsys, name, version, sumFile)
 	if err != nil {
-		log.Warnf("failed to open mod file %s@%s %s: %v", info.Path, info.Version, modFile, err)
+		return nil, fmt.Errorf("failed to read %s for %s: %v", sumFile, info, err)
+	}
+
+	f, openErr := openModuleFile(fsys, name, version, modFile)
+	if openErr != nil {
+		log.Warnf("failed to open mod file %s %s: %v", info, modFile, openErr)
 	} else {
 		defer f.Close()
 		mod, err := pkg.ParseMod(f)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse mod file %s@%s %s: %v", info.Path, info.Version, modFile, err)
+			return nil, fmt.Errorf("failed to parse mod file %s %s: %v", info, modFile, err)
 		}
-		for _, p := range mod.Requires {
-			if _, ok := existing[p.String()]; ok {
-				continue
+		requires := mod.Requires
+		if opts.buildList {
+			if requires, err = pkg.BuildList(ctx, mod, proxyURL); err != nil {
+				return nil, fmt.Errorf("failed to compute build list for %s: %v", info, err)
 			}
-			// was it replaced? Try by version and then by name
-			var (
-				replaced bool
-				info     pkgInfo
-			)
-			if r, ok := mod.Replace[p.String()]; ok {
-				p = r
-				replaced = true
-			} else if r, ok := mod.Replace[p.Name]; ok {
-				p = r
-				replaced = true
+		}
+		resolved, added, err := writeRequirements(outpath, prefix, requires, resolveReplacements(mod.Replace, opts.dir), sums, existing, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range requires {
+			if d, ok := resolved[p.Name]; ok {
+				pkgInfos[0].Dependencies = append(pkgInfos[0].Dependencies, d)
 			}
-			// is the module a path one due to replaces? We ignore those
-			if replaced && p.Version == "" {
+		}
+		pkgInfos = append(pkgInfos, added...)
+	}
+	return
+}
+
+// writeRequirements writes each of the required modules, after applying replacements, unless it already exists.
+// Modules replaced by local directories are written from those directories, which must be absolute,
+// with a version calculated from their repository.
+// It returns the information of each module written, and resolved, the module@version used for each required
+// module path. Requirements that were skipped, because they provide no packages, or are replaced by a directory
+// that could not be resolved, are not in resolved.
+func writeRequirements(outpath, prefix string, requires []pkg.Package, replace map[string]pkg.Package, sums map[string]string, existing map[string]bool, opts sourceOptions) (resolved map[string]string, pkgInfos []pkgInfo, err error) {
+	// modules from the proxy are retrieved in the background, and collected in order once all have been started
+	type requirement struct {
+		required, p pkg.Package
+		replaced    bool
+		fetch       *moduleFetch
+	}
+	var pending []requirement
+	resolved = make(map[string]string)
+	for _, p := range requires {
+		if opts.modules != nil && !opts.modules[p.Name] {
+			log.Debugf("skipping %s, which provides no imported packages", p)
+			continue
+		}
+		if _, ok := existing[p.String()]; ok {
+			resolved[p.Name] = p.String()
+			continue
+		}
+		// was it replaced? Try by version and then by name
+		r := requirement{required: p, p: p}
+		if rp, ok := replace[p.String()]; ok {
+			r.p, r.replaced = rp, true
+		} else if rp, ok := replace[p.Name]; ok {
+			r.p, r.replaced = rp, true
+		}
+		if r.replaced && r.p.Version == "" {
+			// replaced by a local directory
+			if !filepath.IsAbs(r.p.Name) {
+				log.Warnf("skipping %s, replaced by directory %s, which cannot be resolved outside of a source directory", p, r.p.Name)
 				continue
 			}
-			_, info, err = getAndWriteModule(outpath, prefix, p.Name, p.Version)
+		} else {
+			r.fetch = fetcher.start(outpath, prefix, r.p.Name, r.p.Version, sums)
+		}
+		pending = append(pending, r)
+	}
 
-			if err != nil {
-				return nil, fmt.Errorf("failed to get package %s@%s: %v", p.Name, p.Version, err)
-			}
-			existing[p.String()] = true
-			pkgInfos = append(pkgInfos, info)
+	for _, r := range pending {
+		var info pkgInfo
+		if r.fetch != nil {
+			info, err = r.fetch.wait()
+		} else {
+			info, err = writeLocalModule(outpath, prefix, r.required.Name, r.p.Name)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get package %s: %v", r.p, err)
+		}
+		if r.replaced {
+			info.Replaced = r.required.String()
 		}
+		resolved[r.required.Name] = info.String()
+		if existing[info.String()] {
+			continue
+		}
+		existing[info.String()] = true
+		pkgInfos = append(pkgInfos, info)
 	}
 	return
 }
 
-func writeModuleFromBinary(outpath, prefix string, r io.ReaderAt, existing map[string]bool) (pkgInfos []pkgInfo, err error) {
-	info, err := buildinfo.Read(r)
+// openModuleFile opens the named file at the root of the module in fsys. Module zips hold all of their files
+// under a single module@version directory, for the module path and version of the zip, while local directories
+// hold them at the root.
+func openModuleFile(fsys fs.FS, modPath, version, name string) (fs.File, error) {
+	if zr, ok := pkg.ZipReader(fsys); ok {
+		return zr.Open(fmt.Sprintf("%s@%s/%s", modPath, version, name))
+	}
+	return fsys.Open(name)
+}
+
+// readSums reads the hashes of all modules in the named go.sum of the module modPath@version in fsys, keyed by
+// module@version. A module without a go.sum has no hashes.
+func readSums(fsys fs.FS, modPath, version, name string) (map[string]string, error) {
+	f, err := openModuleFile(fsys, modPath, version, name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read build info: %v", err)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	sums := make(map[string]string)
+	for _, p := range pkg.ParseSum(f) {
+		sums[p.String()] = p.Hash
 	}
+	return sums, nil
+}
+
+// writeModuleFromBinary writes the main module of the go binary with the given build info, if it can be retrieved,
+// each of the modules it depends on, and the go standard library and runtime that are linked into it. The source
+// of the standard library is written only if toolchainSource is true.
+func writeModuleFromBinary(ctx context.Context, outpath, prefix string, info *buildinfo.BuildInfo, existing map[string]bool, toolchainSource bool) (pkgInfos []pkgInfo, bin binaryInfo, err error) {
 	name, version := info.Main.Path, info.Main.Version
+	bin = binaryInfo{Module: name, GoVersion: info.GoVersion, Settings: info.Settings, Build: parseBuildMetadata(info.Settings)}
 
 	// we will not consider it an error if we cannot retrieve the version if it was calculated from ldflags,
 	// only if it was actually part of the official binary itself
@@ -340,39 +622,198 @@ func writeModuleFromBinary(outpath, prefix string, r io.ReaderAt, existing map[s
 	// try to parse version from build flags
 	if version == "" || version == "(devel)" {
 		version = parseVersionFromBuildFlags(info.Settings)
+		// failing that, a binary built from a checkout records the revision, from which the source can be found
+		if version == "" && bin.Build.Revision != "" {
+			if pseudo, err := pkg.PseudoVersion(name, bin.Build.Revision, bin.Build.Time); err != nil {
+				log.Debugf("cannot calculate pseudo-version of %s: %v", name, err)
+			} else {
+				version = pseudo
+				if bin.Build.Modified {
+					log.Warnf("%s was built from a modified checkout of revision %s, so its source may differ from %s", name, bin.Build.Revision, version)
+				}
+			}
+		}
+		calculatedVersion = true
+	}
+	// newer versions of go stamp a build from a modified checkout with +dirty, which cannot be retrieved,
+	// so retrieve the revision it was modified from
+	if strings.HasSuffix(version, "+dirty") {
+		log.Warnf("%s was built from a modified checkout of %s, so its source may differ", name, version)
+		version = strings.TrimSuffix(version, "+dirty")
+		calculatedVersion = true
+	}
+	// they also stamp a build from a checkout with a pseudo-version of its revision, which may never have been
+	// published, so it is no more certain to be retrievable than one calculated here
+	if bin.Build.Revision != "" && module.IsPseudoVersion(version) {
 		calculatedVersion = true
 	}
+	bin.Version = version
+
+	// the binary records the go.sum hash of every module it was built from, against which to verify them
+	sums := make(map[string]string)
+	if info.Main.Sum != "" {
+		sums[fmt.Sprintf("%s@%s", name, version)] = info.Main.Sum
+	}
+	for _, d := range info.Deps {
+		if r := d.Replace; r != nil {
+			if r.Sum != "" {
+				sums[fmt.Sprintf("%s@%s", r.Path, r.Version)] = r.Sum
+			}
+		} else if d.Sum != "" {
+			sums[fmt.Sprintf("%s@%s", d.Path, d.Version)] = d.Sum
+		}
+	}
+
+	// the main module, if we could retrieve it, depends on every module in the binary
+	var main *pkgInfo
 	if version != "" && version != "(devel)" {
-		_, info, err := getAndWriteModule(outpath, prefix, name, version)
-		if err != nil && !calculatedVersion {
-			return nil, fmt.Errorf("failed to get package %s@%s: %v", name, version, err)
+		info, err := getAndWriteModule(ctx, outpath, prefix, name, version, sums)
+		if err != nil {
+			// a calculated version may never have been published, so is reported without its source,
+			// unless it was retrieved but not what the binary was built from
+			if !calculatedVersion || ctx.Err() != nil || errors.As(err, &pkg.ErrHashMismatch{}) {
+				return nil, bin, fmt.Errorf("failed to get package %s@%s: %w", name, version, err)
+			}
+			log.Warnf("failed to get %s@%s, which the binary was built from, so its source is not written: %v", name, version, err)
+			info = pkgInfo{Module: name, Version: version, Unavailable: fmt.Sprintf("the version the binary was built from could not be retrieved: %v", err)}
+		}
+		info.Build = bin.Build
+		existing[info.String()] = true
+		bin.Modules = append(bin.Modules, info.String())
+		pkgInfos = append(pkgInfos, info)
+		main = &pkgInfos[0]
+	}
+
+	// start retrieving every dependency in the background, then collect them in order
+	fetches := make(map[string]*moduleFetch)
+	for _, d := range info.Deps {
+		if d.Version == "" || d.Version == "(devel)" {
+			continue
 		}
-		if err == nil {
-			existing[info.String()] = true
-			pkgInfos = append(pkgInfos, info)
+		name, version := d.Path, d.Version
+		if r := d.Replace; r != nil {
+			if r.Version == "" || r.Version == "(devel)" {
+				continue
+			}
+			name, version = r.Path, r.Version
+		}
+		if key := fmt.Sprintf("%s@%s", name, version); !existing[key] {
+			fetches[key] = fetcher.start(outpath, prefix, name, version, sums)
 		}
 	}
 
+	var deps []pkgInfo
 	for _, d := range info.Deps {
 		if d.Version == "" || d.Version == "(devel)" {
 			continue
 		}
-		if _, ok := existing[fmt.Sprintf("%s@%s", d.Path, d.Version)]; ok {
+		required := fmt.Sprintf("%s@%s", d.Path, d.Version)
+		// a replaced module was built from its replacement, which is what we need to retrieve
+		name, version := d.Path, d.Version
+		if r := d.Replace; r != nil {
+			// local directories have no version, recorded as (devel)
+			if r.Version == "" || r.Version == "(devel)" {
+				// there is no way to know what was in the directory when the binary was built, and its path
+				// is on the machine that built it, so it is reported as the required module
+				log.Warnf("cannot retrieve %s, replaced by local directory %s when the binary was built", required, r.Path)
+				p := pkgInfo{Module: d.Path, Version: d.Version, Unavailable: "replaced by a local directory when the binary was built"}
+				bin.Modules = append(bin.Modules, p.String())
+				if _, ok := existing[p.String()]; !ok {
+					existing[p.String()] = true
+					deps = append(deps, p)
+				}
+				if main != nil {
+					main.Dependencies = append(main.Dependencies, p.String())
+				}
+				continue
+			}
+			name, version = r.Path, r.Version
+		}
+		key := fmt.Sprintf("%s@%s", name, version)
+		if _, ok := existing[key]; ok {
+			bin.Modules = append(bin.Modules, key)
+			if main != nil {
+				main.Dependencies = append(main.Dependencies, key)
+			}
 			continue
 		}
-		_, info, err := getAndWriteModule(outpath, prefix, d.Path, d.Version)
+		info, err := fetches[key].wait()
 		if err != nil {
 			if errors.Is(err, ErrNoModFile{}) {
 				continue
 			}
-			return nil, fmt.Errorf("failed to get package %s@%s: %v", d.Path, d.Version, err)
+			return nil, bin, fmt.Errorf("failed to get package %s: %v", key, err)
+		}
+		if d.Replace != nil {
+			info.Replaced = required
 		}
 		existing[info.String()] = true
-		pkgInfos = append(pkgInfos, info)
+		bin.Modules = append(bin.Modules, info.String())
+		if main != nil {
+			main.Dependencies = append(main.Dependencies, info.String())
+		}
+		deps = append(deps, info)
+	}
+
+	if goVersion := pkg.ToolchainVersion(info.GoVersion); goVersion != "" {
+		key := fmt.Sprintf("%s@%s", pkg.StdlibModule, goVersion)
+		if _, ok := existing[key]; !ok {
+			std, err := writeStdlib(ctx, outpath, prefix, goVersion, toolchainSource)
+			if err != nil {
+				return nil, bin, err
+			}
+			existing[key] = true
+			deps = append(deps, std)
+		}
+		bin.Modules = append(bin.Modules, key)
+		if main != nil {
+			main.Dependencies = append(main.Dependencies, key)
+		}
 	}
+	pkgInfos = append(pkgInfos, deps...)
 	return
 }
 
+// annotateBinaries records in each package the paths of the binaries into which it was built.
+func annotateBinaries(pkgInfos []pkgInfo, binaries []binaryInfo) {
+	paths := make(map[string][]string)
+	for _, b := range binaries {
+		for _, m := range b.Modules {
+			paths[m] = append(paths[m], b.Path)
+		}
+	}
+	for i := range pkgInfos {
+		pkgInfos[i].Binaries = paths[pkgInfos[i].String()]
+	}
+}
+
+// writeStdlib returns the go standard library and runtime of the given go version, e.g. go1.21.5, writing
+// its source only if withSource is true, as it is large.
+func writeStdlib(ctx context.Context, outpath, prefix, goVersion string, withSource bool) (p pkgInfo, err error) {
+	p = pkgInfo{Module: pkg.StdlibModule, Version: goVersion}
+	if withSource && outpath != "" {
+		fsys, err := pkg.GetToolchainSource(ctx, goVersion, proxyURL)
+		switch {
+		case ctx.Err() != nil:
+			return p, ctx.Err()
+		case err != nil:
+			// the standard library is still reported, just without its source
+			log.Warnf("failed to get source of %s, so it is not written: %v", goVersion, err)
+			p.Unavailable = fmt.Sprintf("failed to get source: %v", err)
+		default:
+			defer closeModule(fsys)
+			log.Printf("writing source of go %s", goVersion)
+			if p, err = writeModule(outpath, prefix, pkg.StdlibModule, goVersion, fsys); err != nil {
+				return p, fmt.Errorf("failed to write source of go %s: %v", goVersion, err)
+			}
+		}
+	}
+	// the source has licenses for the many third-party packages within it, but the distribution has just the one
+	p.Licenses = []string{pkg.GoLicense}
+	p.Source = pkg.ToolchainDownloadURL(goVersion)
+	return p, nil
+}
+
 func writeModule(outpath, prefix, name, version string, fsys fs.FS) (p pkgInfo, err error) {
 	// do we need the modFile? Depends on if the name was given
 	if name == "" {
@@ -400,26 +841,146 @@ func writeModule(outpath, prefix, name, version string, fsys fs.FS) (p pkgInfo,
 	if err != nil {
 		return p, fmt.Errorf("failed to create output file %s: %v", outpath, err)
 	}
-	defer w.Close()
 	zw := zip.NewWriter(w)
-	defer zw.Close()
-	pkgLicenses, err := pkg.WriteToZip(fsys, zw)
+	pkgLicenses, licenseFiles, err := pkg.WriteToZipWithLicenseFiles(fsys, zw)
 	if err != nil {
+		_ = zw.Close()
+		_ = w.Close()
 		return p, fmt.Errorf("failed to write to zip: %v", err)
 	}
-	p = pkgInfo{Module: name, Version: version, Licenses: pkgLicenses, Path: filename}
+	// the zip must be completely flushed to disk before we can checksum it
+	if err := zw.Close(); err != nil {
+		_ = w.Close()
+		return p, fmt.Errorf("failed to close zip: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return p, fmt.Errorf("failed to close output file %s: %v", filename, err)
+	}
+	p = pkgInfo{Module: name, Version: version, Licenses: pkgLicenses, Path: filename, LicenseFiles: licenseFiles}
+	if filename != "" {
+		p.Checksum, err = fileChecksum(filepath.Join(outpath, filename))
+		if err != nil {
+			return p, fmt.Errorf("failed to checksum output file %s: %v", filename, err)
+		}
+	}
 	return
 }
 
-func getAndWriteModule(outpath, prefix, name, version string) (fsys fs.FS, p pkgInfo, err error) {
-	fsys, err = pkg.GetModule(name, version, proxyURL, false)
+// getAndWriteModule retrieves the module and writes it to the output. If sums, the hashes from a go.sum,
+// has a hash for the module, the module contents must match it. Otherwise, if a checksum database is configured,
+// the module contents must match the hash it records. The hash of the contents is always recorded, with a warning
+// if there was nothing to verify it against. A module whose hash is known is taken from the result cache if it is
+// there, and stored in it if not.
+func getAndWriteModule(ctx context.Context, outpath, prefix, name, version string, sums map[string]string) (p pkgInfo, err error) {
+	expected, from, err := expectedHash(name, version, sums)
 	if err != nil {
-		return fsys, p, fmt.Errorf("failed to get module %s: %v", name, err)
+		return p, err
+	}
+	if expected != "" {
+		if p, ok := cachedModule(outpath, prefix, name, version, expected); ok {
+			log.Debugf("found %s@%s in result cache", name, version)
+			p.Source = downloadLocation(name, version)
+			return p, nil
+		}
+	}
+	fsys, err := pkg.GetModule(ctx, name, version, proxyURL, false)
+	if err != nil {
+		return p, fmt.Errorf("failed to get module %s: %v", name, err)
+	}
+	defer closeModule(fsys)
+	var hash string
+	if expected != "" {
+		if hash, err = pkg.VerifyModule(fsys, name, version, expected); err != nil {
+			return p, fmt.Errorf("failed to verify module %s@%s against %s: %w", name, version, from, err)
+		}
+		log.Debugf("verified %s@%s against %s", name, version, from)
+	} else {
+		if hash, err = pkg.HashModule(fsys, name, version); err != nil {
+			return p, fmt.Errorf("failed to hash module %s@%s: %v", name, version, err)
+		}
+		// only verified modules are cached, so one with the same hash as a cached result is verified too
+		if p, ok := cachedModule(outpath, prefix, name, version, hash); ok {
+			log.Debugf("found %s@%s in result cache by its hash %s", name, version, hash)
+			p.Source = downloadLocation(name, version)
+			return p, nil
+		}
+		log.Warnf("module %s@%s is in no go.sum or checksum database, so its hash %s is not verified", name, version, hash)
 	}
 	p, err = writeModule(outpath, prefix, name, version, fsys)
+	p.Source = downloadLocation(name, version)
+	p.Hash = hash
+	p.Verified = expected != ""
+	if err == nil && p.Verified {
+		cacheModule(outpath, p)
+	}
 	return
 }
 
+// expectedHash returns the h1: hash that the module must have, from sums, the hashes from a go.sum, or else from
+// the checksum database, if one is configured, along with where it came from. It is empty if neither has one.
+func expectedHash(name, version string, sums map[string]string) (hash, from string, err error) {
+	if expected, ok := sums[fmt.Sprintf("%s@%s", name, version)]; ok {
+		return expected, sumFile, nil
+	}
+	if sumDB == nil {
+		return "", "", nil
+	}
+	expected, err := sumDB.Hash(name, version)
+	switch {
+	case errors.Is(err, pkg.ErrNoSumDB):
+		log.Debugf("not verifying %s@%s against checksum database, matches GONOSUMDB", name, version)
+		return "", "", nil
+	case err != nil:
+		return "", "", fmt.Errorf("failed to look up module %s@%s in checksum database: %v", name, version, err)
+	}
+	return expected, "checksum database", nil
+}
+
+// writeLocalModule writes the module modPath from the local directory dir that replaced it. Its version is
+// calculated from the repository containing the directory, if any.
+func writeLocalModule(outpath, prefix, modPath, dir string) (pkgInfo, error) {
+	version := GoVersion(dir)
+	log.Printf("writing module %s from replacement directory %s", modPath, dir)
+	return writeModule(outpath, prefix, modPath, version, os.DirFS(dir))
+}
+
+// resolveReplacements returns the replacements with each local directory made absolute, relative to dir.
+// If dir is empty, the module is not on disk, and the replacements are returned unchanged.
+func resolveReplacements(replace map[string]pkg.Package, dir string) map[string]pkg.Package {
+	if dir == "" {
+		return replace
+	}
+	resolved := make(map[string]pkg.Package, len(replace))
+	for k, r := range replace {
+		if r.Version == "" && !filepath.IsAbs(r.Name) {
+			if abs, err := filepath.Abs(filepath.Join(dir, r.Name)); err == nil {
+				r.Name = abs
+			}
+		}
+		resolved[k] = r
+	}
+	return resolved
+}
+
+// downloadLocation returns the URL from which the zip for the given module version can be retrieved.
+func downloadLocation(name, version string) string {
+	return pkg.DownloadURL(proxyURL, name, version)
+}
+
+// fileChecksum returns the hex-encoded sha256 checksum of the file at the given path.
+func fileChecksum(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 // GoVersion calculates the go version to use for the given module.
 // Assumes existence of git command on the path.
 func GoVersion(dir string) string {
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deitch/go-sources-and-licenses/pkg"
+)
+
+const (
+	spdxVersion     = "SPDX-2.3"
+	spdxDataLicense = "CC0-1.0"
+	spdxDocumentID  = "SPDXRef-DOCUMENT"
+	spdxNoAssertion = "NOASSERTION"
+	spdxNamespace   = "https://github.com/deitch/go-sources-and-licenses/spdx"
+	toolName        = "go-sources-and-licenses"
+)
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	PackageFileName  string            `json:"packageFileName,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	SourceInfo       string            `json:"sourceInfo,omitempty"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+	Comment          string            `json:"comment,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+var (
+	spdxInvalidIDChars      = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+	spdxInvalidLicenseChars = regexp.MustCompile(`[^A-Za-z0-9.+-]+`)
+)
+
+// writeSPDX writes an SPDX 2.3 JSON document describing the given packages to w.
+func writeSPDX(w io.Writer, name string, pkgInfos []pkgInfo) error {
+	uuid, err := newUUID()
+	if err != nil {
+		return fmt.Errorf("failed to generate document namespace: %v", err)
+	}
+	docName := filepath.Base(name)
+	doc := spdxDocument{
+		SPDXVersion:       spdxVersion,
+		DataLicense:       spdxDataLicense,
+		SPDXID:            spdxDocumentID,
+		Name:              docName,
+		DocumentNamespace: fmt.Sprintf("%s/%s-%s", spdxNamespace, spdxInvalidIDChars.ReplaceAllString(docName, "-"), uuid),
+		CreationInfo: spdxCreationInfo{
+			Created:  time.Now().UTC().Format(time.RFC3339),
+			Creators: []string{fmt.Sprintf("Tool: %s", toolName)},
+		},
+		Packages:      []spdxPackage{},
+		Relationships: []spdxRelationship{},
+	}
+
+	// assign every package a unique SPDX identifier
+	ids := make(map[string]string)
+	used := make(map[string]bool)
+	for _, p := range pkgInfos {
+		if _, ok := ids[p.String()]; ok {
+			continue
+		}
+		id := "SPDXRef-Package-" + spdxInvalidIDChars.ReplaceAllString(p.String(), "-")
+		for i := 2; used[id]; i++ {
+			id = fmt.Sprintf("SPDXRef-Package-%s-%d", spdxInvalidIDChars.ReplaceAllString(p.String(), "-"), i)
+		}
+		used[id] = true
+		ids[p.String()] = id
+
+		license := spdxLicenseExpression(p.Licenses)
+		sp := spdxPackage{
+			Name:             p.Module,
+			SPDXID:           id,
+			VersionInfo:      p.Version,
+			PackageFileName:  p.Path,
+			DownloadLocation: spdxNoAssertion,
+			LicenseConcluded: license,
+			LicenseDeclared:  license,
+			CopyrightText:    spdxNoAssertion,
+		}
+		if p.Source != "" {
+			sp.DownloadLocation = p.Source
+		}
+		if p.Checksum != "" {
+			sp.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: p.Checksum}}
+		}
+		if build := p.Build.String(); build != "" {
+			sp.SourceInfo = fmt.Sprintf("binary built from %s", build)
+		}
+		// SPDX has no checksum algorithm for the go.sum hash, so it can only be recorded as a comment
+		var comments []string
+		switch {
+		case p.Verified:
+			comments = append(comments, fmt.Sprintf("go.sum hash verified: %s", p.Hash))
+		case p.Hash != "":
+			comments = append(comments, fmt.Sprintf("go.sum hash, not verified: %s", p.Hash))
+		}
+		if p.Replaced != "" {
+			comments = append(comments, fmt.Sprintf("replaces %s", p.Replaced))
+		}
+		if p.Unavailable != "" {
+			comments = append(comments, fmt.Sprintf("source unavailable: %s", p.Unavailable))
+		}
+		if len(p.Binaries) > 0 {
+			comments = append(comments, fmt.Sprintf("built into %s", strings.Join(p.Binaries, ", ")))
+		}
+		sp.Comment = strings.Join(comments, "; ")
+		if p.Version != "" {
+			sp.ExternalRefs = []spdxExternalRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: purl(p.Module, p.Version)}}
+		}
+		doc.Packages = append(doc.Packages, sp)
+	}
+
+	roots := rootPackages(pkgInfos)
+	isRoot := make(map[int]bool)
+	for _, i := range roots {
+		isRoot[i] = true
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      spdxDocumentID,
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: ids[pkgInfos[i].String()],
+		})
+	}
+	unknown := make(map[string]bool)
+	for i, p := range pkgInfos {
+		// only the dependencies of the scanned modules are known, so for the modules they depend on,
+		// say so rather than leave it to be read as having none
+		if len(p.Dependencies) == 0 && !isRoot[i] {
+			if unknown[p.String()] {
+				continue
+			}
+			unknown[p.String()] = true
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				SPDXElementID:      ids[p.String()],
+				RelationshipType:   "DEPENDS_ON",
+				RelatedSPDXElement: spdxNoAssertion,
+			})
+			continue
+		}
+		for _, d := range p.Dependencies {
+			// we only can relate to packages that are in the document
+			dep, ok := ids[d]
+			if !ok {
+				continue
+			}
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				SPDXElementID:      ids[p.String()],
+				RelationshipType:   "DEPENDS_ON",
+				RelatedSPDXElement: dep,
+			})
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// spdxLicenseExpression converts the license IDs found by licensecheck, which are SPDX identifiers,
+// into a single SPDX license expression. Unknown licenses cannot be expressed, so if nothing
+// else was found, the result is NOASSERTION.
+func spdxLicenseExpression(licenses []string) string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, l := range licenses {
+		if l == pkg.UnknownLicenseType {
+			continue
+		}
+		l = spdxInvalidLicenseChars.ReplaceAllString(l, "-")
+		if seen[l] {
+			continue
+		}
+		seen[l] = true
+		ids = append(ids, l)
+	}
+	if len(ids) == 0 {
+		return spdxNoAssertion
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, " AND ")
+}
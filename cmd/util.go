@@ -1,9 +1,54 @@
 package cmd
 
-import "io"
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"strings"
+)
 
 type NopWriteCloser struct {
 	io.Writer
 }
 
 func (NopWriteCloser) Close() error { return nil }
+
+// closeModule releases a module retrieved by pkg.GetModule once done with it, if it is read from a file.
+func closeModule(fsys fs.FS) {
+	if c, ok := fsys.(io.Closer); ok {
+		_ = c.Close()
+	}
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// purl returns the package URL for a go module at the given version.
+func purl(module, version string) string {
+	parts := strings.Split(module, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return fmt.Sprintf("pkg:golang/%s@%s", strings.Join(parts, "/"), url.PathEscape(version))
+}
+
+// countTrue returns how many of the flags are set.
+func countTrue(flags ...bool) int {
+	var n int
+	for _, f := range flags {
+		if f {
+			n++
+		}
+	}
+	return n
+}
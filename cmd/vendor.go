@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/deitch/go-sources-and-licenses/pkg"
+)
+
+// writeModuleFromVendor writes the module in fsys, and each of the modules in its vendor directory, as listed
+// in vendor/modules.txt. The sources of the vendored modules are taken from the vendor directory, so nothing
+// is retrieved from the network. A module replaced by another is reported under the replacement version,
+// and one replaced by a local directory with a version calculated from the repository of that directory,
+// if opts.dir is set.
+func writeModuleFromVendor(outpath, prefix, version string, fsys fs.FS, existing map[string]bool, opts sourceOptions) (pkgInfos []pkgInfo, err error) {
+	info, err := writeModule(outpath, prefix, "", version, fsys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get package: %w", err)
+	}
+	pkgInfos = append(pkgInfos, info)
+	existing[info.String()] = true
+
+	f, err := fsys.Open(path.Join(pkg.VendorDir, pkg.ModulesTxt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s/%s for %s: %v", pkg.VendorDir, pkg.ModulesTxt, info, err)
+	}
+	defer f.Close()
+	mods, err := pkg.ParseVendor(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s/%s for %s: %v", pkg.VendorDir, pkg.ModulesTxt, info, err)
+	}
+	vendor, err := fs.Sub(fsys, pkg.VendorDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range mods {
+		// modules that are required, but provide no packages, have nothing vendored
+		if len(m.Packages) == 0 {
+			continue
+		}
+		if opts.modules != nil && !opts.modules[m.Name] {
+			log.Debugf("skipping %s, which provides no imported packages", m.Package)
+			continue
+		}
+		name, version := m.Name, m.Version
+		if m.Replace != nil {
+			version = m.Replace.Version
+			// a module replaced by another module is reported as the replacement, as for requirements in a go.mod
+			if version != "" {
+				name = m.Replace.Name
+			}
+			if version == "" && opts.dir != "" {
+				if dir := m.Replace.Name; filepath.IsAbs(dir) {
+					version = GoVersion(dir)
+				} else {
+					version = GoVersion(filepath.Join(opts.dir, dir))
+				}
+			}
+		}
+		p := pkg.Package{Name: name, Version: version}
+		if _, ok := existing[p.String()]; ok {
+			pkgInfos[0].Dependencies = append(pkgInfos[0].Dependencies, p.String())
+			continue
+		}
+		modFS, err := pkg.VendoredModuleFS(vendor, m.Name, mods)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vendored module %s: %v", m.Name, err)
+		}
+		info, err := writeModule(outpath, prefix, name, version, modFS)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write vendored module %s: %v", p, err)
+		}
+		if m.Replace != nil {
+			info.Replaced = m.Package.String()
+		}
+		existing[info.String()] = true
+		pkgInfos[0].Dependencies = append(pkgInfos[0].Dependencies, info.String())
+		pkgInfos = append(pkgInfos, info)
+	}
+	return pkgInfos, nil
+}
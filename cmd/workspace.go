@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/mod/semver"
+
+	"github.com/deitch/go-sources-and-licenses/pkg"
+)
+
+const (
+	workFile    = "go.work"
+	workSumFile = "go.work.sum"
+)
+
+// workspace is a go.work and the modules it uses.
+type workspace struct {
+	dir  string        // directory of the go.work
+	work *pkg.WorkFile // the parsed go.work
+	dirs []string      // absolute directory of each workspace module
+}
+
+// findWorkspace returns the workspace that applies to the module in dir, or nil if there is none.
+func findWorkspace(dir string) (*workspace, error) {
+	workPath, err := pkg.FindWorkFile(dir)
+	if err != nil || workPath == "" {
+		return nil, err
+	}
+	ws, err := loadWorkspace(workPath)
+	if err != nil {
+		return nil, err
+	}
+	if !ws.covers(dir) {
+		log.Warnf("%s is not in the workspace %s, ignoring the workspace", dir, workPath)
+		return nil, nil
+	}
+	return ws, nil
+}
+
+// findWorkspaces returns the workspace that applies to dir, if any, and every workspace in the tree under dir.
+func findWorkspaces(dir string) ([]*workspace, error) {
+	var workspaces []*workspace
+	ws, err := findWorkspace(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspace for %s: %v", dir, err)
+	}
+	if ws != nil {
+		workspaces = append(workspaces, ws)
+	}
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() != workFile {
+			return err
+		}
+		found, err := loadWorkspace(p)
+		if err != nil {
+			return err
+		}
+		if ws == nil || found.dir != ws.dir {
+			workspaces = append(workspaces, found)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find workspaces under %s: %v", dir, err)
+	}
+	return workspaces, nil
+}
+
+// loadWorkspace reads the go.work at workPath.
+func loadWorkspace(workPath string) (*workspace, error) {
+	f, err := os.Open(workPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", workPath, err)
+	}
+	defer f.Close()
+	work, err := pkg.ParseWork(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", workPath, err)
+	}
+	dir, err := filepath.Abs(filepath.Dir(workPath))
+	if err != nil {
+		return nil, err
+	}
+	ws := &workspace{dir: dir, work: work}
+	for _, u := range work.Uses {
+		if !filepath.IsAbs(u) {
+			u = filepath.Join(ws.dir, u)
+		}
+		ws.dirs = append(ws.dirs, filepath.Clean(u))
+	}
+	return ws, nil
+}
+
+// contains reports whether dir is one of the modules of the workspace.
+func (ws *workspace) contains(dir string) bool {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	for _, d := range ws.dirs {
+		if d == abs {
+			return true
+		}
+	}
+	return false
+}
+
+// covers reports whether dir is one of the modules of the workspace, or the directory of the go.work itself.
+func (ws *workspace) covers(dir string) bool {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	return abs == ws.dir || ws.contains(abs)
+}
+
+// writeWorkspace writes every module of the workspace, each as a main module, and a single set of requirements
+// for all of them: the highest version of each module required by any workspace module, or with opts.buildList,
+// the build list of the workspace as a whole. Replacements in the go.work take precedence over those in the modules.
+// If version is empty, the version of each module is calculated from its repository.
+func writeWorkspace(ctx context.Context, outpath, prefix, version string, ws *workspace, existing map[string]bool, opts sourceOptions) (pkgInfos []pkgInfo, err error) {
+	var (
+		mods     []*pkg.ModFile
+		mains    = make(map[string]string)
+		combined = &pkg.ModFile{GoVersion: ws.work.GoVersion, Replace: map[string]pkg.Package{}}
+	)
+	sums, err := readSums(os.DirFS(ws.dir), "", "", workSumFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", workSumFile, err)
+	}
+	if sums == nil {
+		sums = make(map[string]string)
+	}
+
+	for _, dir := range ws.dirs {
+		fsys := os.DirFS(dir)
+		f, err := fsys.Open(modFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s for workspace module %s: %v", modFile, dir, err)
+		}
+		mod, err := pkg.ParseMod(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s for workspace module %s: %v", modFile, dir, err)
+		}
+		v := version
+		if v == "" {
+			v = GoVersion(dir)
+		}
+		log.Printf("writing workspace module %s from directory %s", mod.Name, dir)
+		info, err := writeModule(outpath, prefix, mod.Name, v, fsys)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get package %s@%s: %w", mod.Name, v, err)
+		}
+		existing[info.String()] = true
+		mains[mod.Name] = info.String()
+		mods = append(mods, mod)
+		pkgInfos = append(pkgInfos, info)
+
+		modSums, err := readSums(fsys, "", "", sumFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s for %s: %v", sumFile, info, err)
+		}
+		for k, h := range modSums {
+			sums[k] = h
+		}
+		for k, r := range resolveReplacements(mod.Replace, dir) {
+			combined.Replace[k] = r
+		}
+	}
+	for k, r := range resolveReplacements(ws.work.Replace, ws.dir) {
+		combined.Replace[k] = r
+	}
+	// workspace modules are always used from the workspace, whichever versions of them are required
+	for i, mod := range mods {
+		combined.Replace[mod.Name] = pkg.Package{Name: ws.dirs[i]}
+	}
+
+	selected := make(map[string]string)
+	for _, mod := range mods {
+		for _, r := range mod.Requires {
+			if _, ok := mains[r.Name]; ok {
+				continue
+			}
+			if v, ok := selected[r.Name]; !ok || semver.Compare(r.Version, v) > 0 {
+				selected[r.Name] = r.Version
+			}
+		}
+	}
+	for name, v := range selected {
+		combined.Requires = append(combined.Requires, pkg.Package{Name: name, Version: v})
+	}
+	sort.Slice(combined.Requires, func(i, j int) bool { return combined.Requires[i].Name < combined.Requires[j].Name })
+
+	requires := combined.Requires
+	if opts.buildList {
+		list, err := pkg.BuildList(ctx, combined, proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute build list for workspace %s: %v", ws.dir, err)
+		}
+		requires = nil
+		for _, r := range list {
+			if _, ok := mains[r.Name]; !ok {
+				requires = append(requires, r)
+			}
+		}
+	}
+
+	resolved, added, err := writeRequirements(outpath, prefix, requires, combined.Replace, sums, existing, opts)
+	if err != nil {
+		return nil, err
+	}
+	// each workspace module depends on the versions selected for the workspace as a whole
+	for i, mod := range mods {
+		for _, r := range mod.Requires {
+			if d, ok := mains[r.Name]; ok {
+				pkgInfos[i].Dependencies = append(pkgInfos[i].Dependencies, d)
+			} else if d, ok := resolved[r.Name]; ok {
+				pkgInfos[i].Dependencies = append(pkgInfos[i].Dependencies, d)
+			}
+		}
+	}
+	pkgInfos = append(pkgInfos, added...)
+	return pkgInfos, nil
+}
@@ -6,6 +6,7 @@ require (
 	github.com/google/licensecheck v0.3.1
 	github.com/sirupsen/logrus v1.9.0
 	github.com/spf13/cobra v1.6.1
+	golang.org/x/mod v0.20.0
 )
 
 require (
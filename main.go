@@ -1,13 +1,22 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/deitch/go-sources-and-licenses/cmd"
 )
 
 func main() {
-	if err := cmd.New().Execute(); err != nil {
+	// interrupting cancels any requests and git commands in flight
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := cmd.New().ExecuteContext(ctx)
+	// log.Fatalf exits without running deferred calls, so restore the default signal handling first
+	stop()
+	if err != nil {
 		log.Fatalf("error during command execution: %v", err)
 	}
 }
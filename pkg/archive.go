@@ -0,0 +1,220 @@
+package pkg
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ArchiveSeparator separates the path of an archive from the path of a member within it, e.g.
+	// release.tar.gz!/bin/app
+	ArchiveSeparator = "!/"
+
+	// DefaultArchiveMaxDepth is how many archives deep to look by default, e.g. 2 for a zip within a tar.gz
+	DefaultArchiveMaxDepth = 3
+	// DefaultArchiveMaxSize is the default size of the largest archive member to read, uncompressed
+	DefaultArchiveMaxSize = 1 << 30
+
+	// members up to this size are kept in memory while being read, larger ones are written to a temporary file
+	spoolMemoryLimit = 32 << 20
+
+	tarMagicOffset = 257
+)
+
+type archiveKind int
+
+const (
+	notArchive archiveKind = iota
+	zipArchive
+	tarArchive
+	gzipArchive
+)
+
+var errTooLarge = errors.New("too large")
+
+// ArchiveOptions limit how far archives are descended into, to protect against archive bombs
+type ArchiveOptions struct {
+	MaxDepth int   // how many archives deep to look; an archive at the limit is not opened
+	MaxSize  int64 // largest member of an archive to read, uncompressed; larger ones are skipped
+}
+
+// IsArchive reports whether r is a zip, tar or gzip compressed archive.
+func IsArchive(r io.ReaderAt) bool {
+	head := make([]byte, tarMagicOffset+8)
+	n, _ := r.ReadAt(head, 0)
+	return detectArchive(head[:n]) != notArchive
+}
+
+// ScanArchive finds the executables in the zip, tar or gzip compressed archive r, of the given size, descending
+// into archives within it as limited by opts. It calls f with the path and contents of every executable, where
+// the path is name, followed by the path of each archive member and separated by ArchiveSeparator.
+func ScanArchive(name string, r io.ReaderAt, size int64, opts ArchiveOptions, f func(p string, r io.ReaderAt) error) error {
+	return scanArchive(name, r, size, 1, opts, f)
+}
+
+func scanArchive(name string, r io.ReaderAt, size int64, depth int, opts ArchiveOptions, f func(p string, r io.ReaderAt) error) error {
+	head := make([]byte, tarMagicOffset+8)
+	n, _ := r.ReadAt(head, 0)
+	switch detectArchive(head[:n]) {
+	case zipArchive:
+		zr, err := zip.NewReader(r, size)
+		if err != nil {
+			return fmt.Errorf("failed to read zip %s: %v", name, err)
+		}
+		for _, file := range zr.File {
+			if file.FileInfo().IsDir() || !file.Mode().IsRegular() {
+				continue
+			}
+			p := name + ArchiveSeparator + file.Name
+			if opts.MaxSize > 0 && file.UncompressedSize64 > uint64(opts.MaxSize) {
+				log.Warnf("skipping %s, which is larger than %d bytes", p, opts.MaxSize)
+				continue
+			}
+			rc, err := file.Open()
+			if err != nil {
+				return fmt.Errorf("failed to open %s: %v", p, err)
+			}
+			err = scanMember(p, rc, depth, opts, f)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case tarArchive:
+		return scanTar(name, io.NewSectionReader(r, 0, size), depth, opts, f)
+	case gzipArchive:
+		gz, err := gzip.NewReader(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return fmt.Errorf("failed to read gzip %s: %v", name, err)
+		}
+		defer gz.Close()
+		br := bufio.NewReader(gz)
+		// usually a compressed tar, which can be read as it is decompressed, else a single compressed file
+		if head, _ := br.Peek(tarMagicOffset + 8); detectArchive(head) == tarArchive {
+			return scanTar(name, br, depth, opts, f)
+		}
+		member := gz.Name
+		if member == "" {
+			member = strings.TrimSuffix(path.Base(name), ".gz")
+		}
+		return scanMember(name+ArchiveSeparator+member, br, depth, opts, f)
+	default:
+		return fmt.Errorf("%s is not a zip, tar or gzip archive", name)
+	}
+}
+
+// scanTar scans the members of the tar archive read from r.
+func scanTar(name string, r io.Reader, depth int, opts ArchiveOptions, f func(p string, r io.ReaderAt) error) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar %s: %v", name, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		p := name + ArchiveSeparator + strings.TrimPrefix(hdr.Name, "./")
+		if opts.MaxSize > 0 && hdr.Size > opts.MaxSize {
+			log.Warnf("skipping %s, which is larger than %d bytes", p, opts.MaxSize)
+			continue
+		}
+		if err := scanMember(p, tr, depth, opts, f); err != nil {
+			return err
+		}
+	}
+}
+
+// scanMember calls f with the archive member p if it is an executable, or scans it if it is itself an archive.
+// Anything else is skipped without being read in full.
+func scanMember(p string, r io.Reader, depth int, opts ArchiveOptions, f func(p string, r io.ReaderAt) error) error {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(tarMagicOffset + 8)
+	kind := detectArchive(head)
+	if kind == notArchive && !hasExecutableMagic(head) {
+		return nil
+	}
+	if kind != notArchive && opts.MaxDepth > 0 && depth >= opts.MaxDepth {
+		log.Warnf("skipping archive %s, which is more than %d archives deep", p, opts.MaxDepth)
+		return nil
+	}
+	ra, size, cleanup, err := spool(br, opts.MaxSize)
+	if errors.Is(err, errTooLarge) {
+		log.Warnf("skipping %s, which is larger than %d bytes", p, opts.MaxSize)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", p, err)
+	}
+	defer cleanup()
+	if kind != notArchive {
+		return scanArchive(p, ra, size, depth+1, opts, f)
+	}
+	return f(p, ra)
+}
+
+// detectArchive returns the kind of archive that starts with head.
+func detectArchive(head []byte) archiveKind {
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return zipArchive
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return gzipArchive
+	case len(head) >= tarMagicOffset+5 && string(head[tarMagicOffset:tarMagicOffset+5]) == "ustar":
+		return tarArchive
+	}
+	return notArchive
+}
+
+// spool reads all of r so that it can be read at random, as needed to read build info or a zip. It is kept in
+// memory if small, else written to a temporary file, which is removed by cleanup. If maxSize is positive and
+// r is larger, errTooLarge is returned.
+func spool(r io.Reader, maxSize int64) (ra io.ReaderAt, size int64, cleanup func(), err error) {
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(r, spoolMemoryLimit+1))
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if maxSize > 0 && n > maxSize {
+		return nil, 0, nil, errTooLarge
+	}
+	if n <= spoolMemoryLimit {
+		return bytes.NewReader(buf.Bytes()), n, func() {}, nil
+	}
+	tmp, err := os.CreateTemp("", "go-sources-and-licenses-*")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	cleanup = func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	src := io.MultiReader(&buf, r)
+	if maxSize > 0 {
+		src = io.LimitReader(src, maxSize+1)
+	}
+	if size, err = io.Copy(tmp, src); err != nil {
+		cleanup()
+		return nil, 0, nil, err
+	}
+	if maxSize > 0 && size > maxSize {
+		cleanup()
+		return nil, 0, nil, errTooLarge
+	}
+	return tmp, size, cleanup, nil
+}
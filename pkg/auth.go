@@ -0,0 +1,446 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	goAuthOff     = "off"
+	goAuthNetrc   = "netrc"
+	goAuthGit     = "git"
+	defaultGoAuth = goAuthNetrc
+)
+
+// auth adds credentials to every HTTP request, as configured by ConfigureAuth
+var auth = &authenticator{credentials: make(map[string]http.Header)}
+
+// AuthOptions configure the credentials sent with HTTP requests
+type AuthOptions struct {
+	// GOAUTH is a list of authentication commands, in the same format as for the go command. If empty,
+	// GOAUTH from the environment is used, else netrc. Its credentials are only ever sent over https.
+	GOAUTH string
+	// Proxies is a GOPROXY list. ProxyHeader is sent with every request to the proxies in it.
+	Proxies     string
+	ProxyHeader http.Header
+}
+
+// authenticator holds the credentials for each URL prefix, from GOAUTH, and those for the proxies.
+// Credentials are never logged.
+type authenticator struct {
+	mu          sync.Mutex
+	commands    [][]string             // each GOAUTH entry, split into words
+	initialized bool                   // whether the commands have been run for every URL
+	credentials map[string]http.Header // keyed by URL prefix, without the https:// scheme
+	proxies     []string
+	proxyHeader http.Header
+}
+
+// ConfigureAuth sets the credentials to send with HTTP requests. The GOAUTH commands are run when first needed.
+func ConfigureAuth(opts AuthOptions) error {
+	goauth := opts.GOAUTH
+	if goauth == "" {
+		goauth = goEnv("GOAUTH")
+	}
+	if goauth == "" {
+		goauth = defaultGoAuth
+	}
+	commands, err := parseGoAuth(goauth)
+	if err != nil {
+		return err
+	}
+	var proxies []string
+	if len(opts.ProxyHeader) > 0 {
+		specs, err := parseProxyList(opts.Proxies)
+		if err != nil {
+			return err
+		}
+		for _, p := range specs {
+			if p.url != proxyDirect && p.url != proxyOff {
+				proxies = append(proxies, p.url+"/")
+			}
+		}
+	}
+
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+	auth.commands = commands
+	auth.initialized = false
+	auth.credentials = make(map[string]http.Header)
+	auth.proxies = proxies
+	auth.proxyHeader = opts.ProxyHeader.Clone()
+	return nil
+}
+
+// parseGoAuth parses and checks a GOAUTH list, which is separated by semicolons.
+func parseGoAuth(goauth string) ([][]string, error) {
+	var commands [][]string
+	entries := strings.Split(goauth, ";")
+	for _, entry := range entries {
+		words := strings.Fields(entry)
+		if len(words) == 0 {
+			return nil, fmt.Errorf("GOAUTH has an empty command: %s", goauth)
+		}
+		switch words[0] {
+		case goAuthOff:
+			if len(entries) != 1 {
+				return nil, fmt.Errorf("GOAUTH=off cannot be combined with other authentication commands: %s", goauth)
+			}
+			return nil, nil
+		case goAuthGit:
+			if len(words) != 2 || !filepath.IsAbs(words[1]) {
+				return nil, fmt.Errorf("GOAUTH git command requires the absolute path of a git working directory: %s", entry)
+			}
+			if fi, err := os.Stat(words[1]); err != nil || !fi.IsDir() {
+				return nil, fmt.Errorf("GOAUTH git command directory %s is not a directory", words[1])
+			}
+		}
+		commands = append(commands, words)
+	}
+	return commands, nil
+}
+
+// addCredentials adds the headers for u to the request: those for the proxies, and, over https, any from GOAUTH.
+func (a *authenticator) addCredentials(ctx context.Context, req *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	u := req.URL.String()
+	for _, p := range a.proxies {
+		if strings.HasPrefix(u, p) {
+			copyHeader(req.Header, a.proxyHeader)
+			break
+		}
+	}
+	if req.URL.Scheme != "https" || len(a.commands) == 0 {
+		return
+	}
+	// as with the go command, every command is run before the first request, and then for a URL that fails
+	if !a.initialized {
+		a.initialized = true
+		a.run(ctx, "", nil)
+	}
+	if h := a.lookup(u); h != nil {
+		copyHeader(req.Header, h)
+	}
+}
+
+// refresh runs the GOAUTH commands again for the URL u, after it failed with res. It returns true if there now are
+// credentials for u, with which the request should be tried again.
+func (a *authenticator) refresh(ctx context.Context, u string, res *http.Response) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !strings.HasPrefix(u, "https://") || !a.hasURLCommands() {
+		return false
+	}
+	a.run(ctx, u, res)
+	return a.lookup(u) != nil
+}
+
+// hasURLCommands reports whether any command can give credentials for a particular URL, which netrc cannot.
+func (a *authenticator) hasURLCommands() bool {
+	for _, words := range a.commands {
+		if words[0] != goAuthNetrc {
+			return true
+		}
+	}
+	return false
+}
+
+// run runs each command, for the URL u and its response res if given, storing the credentials they provide.
+// Earlier commands take precedence, so they are run last. Failures are logged, and otherwise ignored.
+func (a *authenticator) run(ctx context.Context, u string, res *http.Response) {
+	for i := len(a.commands) - 1; i >= 0; i-- {
+		words := a.commands[i]
+		switch words[0] {
+		case goAuthNetrc:
+			lines, err := readNetrc()
+			if err != nil {
+				log.Warnf("GOAUTH=netrc: %v", err)
+				continue
+			}
+			for j := len(lines) - 1; j >= 0; j-- {
+				r := http.Request{Header: make(http.Header)}
+				r.SetBasicAuth(lines[j].login, lines[j].password)
+				a.store(lines[j].machine, r.Header)
+			}
+		case goAuthGit:
+			if u == "" {
+				continue
+			}
+			prefix, header, err := gitCredential(ctx, words[1], u)
+			if err != nil {
+				log.Debugf("GOAUTH=%s: %v", strings.Join(words, " "), err)
+				continue
+			}
+			a.store(prefix, header)
+		default:
+			creds, err := runAuthCommand(ctx, words, u, res)
+			if err != nil {
+				log.Warnf("GOAUTH=%s: %v", strings.Join(words, " "), err)
+				continue
+			}
+			for prefix, header := range creds {
+				a.store(prefix, header)
+			}
+		}
+	}
+}
+
+// lookup returns the headers for the longest prefix of u that has credentials, if any.
+func (a *authenticator) lookup(u string) http.Header {
+	prefix := strings.TrimSuffix(strings.TrimPrefix(u, "https://"), "/")
+	for {
+		if h, ok := a.credentials[prefix]; ok {
+			return h
+		}
+		i := strings.LastIndexByte(prefix, '/')
+		if i < 0 {
+			return nil
+		}
+		prefix = prefix[:i]
+	}
+}
+
+func (a *authenticator) store(prefix string, header http.Header) {
+	prefix = strings.TrimSuffix(strings.TrimPrefix(prefix, "https://"), "/")
+	if len(header) == 0 {
+		delete(a.credentials, prefix)
+		return
+	}
+	a.credentials[prefix] = header
+}
+
+func copyHeader(dst, src http.Header) {
+	for k, vs := range src {
+		for _, v := range vs {
+			dst.Add(k, v)
+		}
+	}
+}
+
+// runAuthCommand runs a GOAUTH command, with the URL u and its response res if given, and returns the
+// headers for each URL prefix that it writes. See go help goauth for the protocol.
+func runAuthCommand(ctx context.Context, words []string, u string, res *http.Response) (map[string]http.Header, error) {
+	args := words[1:]
+	if u != "" {
+		args = append(append([]string(nil), args...), u)
+	}
+	cmd := exec.CommandContext(ctx, words[0], args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if res != nil {
+		var in strings.Builder
+		in.WriteString(res.Proto + " " + res.Status + "\n")
+		for k, v := range res.Header {
+			in.WriteString(k + ": " + strings.Join(v, ", ") + "\n")
+		}
+		in.WriteString("\n")
+		cmd.Stdin = strings.NewReader(in.String())
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseAuthOutput(string(out))
+}
+
+// parseAuthOutput parses the output of a GOAUTH command: sets of URL lines, a blank line, header lines
+// and another blank line.
+func parseAuthOutput(data string) (map[string]http.Header, error) {
+	creds := make(map[string]http.Header)
+	for data != "" {
+		var (
+			line string
+			ok   bool
+			urls []string
+		)
+		for {
+			if line, data, ok = strings.Cut(data, "\n"); !ok {
+				return nil, fmt.Errorf("invalid output: missing empty line after URLs")
+			}
+			if line == "" {
+				break
+			}
+			parsed, err := url.ParseRequestURI(line)
+			if err != nil {
+				return nil, fmt.Errorf("invalid output: invalid URL: %v", err)
+			}
+			urls = append(urls, parsed.String())
+		}
+		header := make(http.Header)
+		for {
+			if line, data, ok = strings.Cut(data, "\n"); !ok {
+				return nil, fmt.Errorf("invalid output: missing empty line after headers")
+			}
+			if line == "" {
+				break
+			}
+			// the line may hold a credential, so never include it in the error
+			name, value, ok := strings.Cut(line, ": ")
+			if !ok || name == "" || strings.ContainsAny(name, " \t") {
+				return nil, fmt.Errorf("invalid output: invalid header line")
+			}
+			header.Add(name, strings.TrimSpace(value))
+		}
+		for _, u := range urls {
+			creds[strings.TrimPrefix(u, "https://")] = header.Clone()
+		}
+	}
+	return creds, nil
+}
+
+// gitCredential asks git for the credentials for the URL u, running git credential fill in dir,
+// and returns the URL prefix they are for, and the headers to send.
+func gitCredential(ctx context.Context, dir, u string) (string, http.Header, error) {
+	cmd := exec.CommandContext(ctx, "git", "credential", "fill")
+	cmd.Dir = dir
+	// never prompt for credentials, we are not interactive
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("url=%s\n", u))
+	out, err := cmd.Output()
+	if err != nil {
+		return "", nil, fmt.Errorf("git credential fill failed for %s: %v", redactURL(u), err)
+	}
+	var (
+		prefix             url.URL
+		username, password string
+	)
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "protocol":
+			prefix.Scheme = value
+		case "host":
+			prefix.Host = value
+		case "path":
+			prefix.Path = value
+		case "username":
+			username = value
+		case "password":
+			password = value
+		case "url":
+			if parsed, err := url.ParseRequestURI(value); err == nil {
+				prefix = *parsed
+			}
+		}
+	}
+	if prefix.Host == "" || !strings.HasPrefix(u, prefix.String()) {
+		return "", nil, fmt.Errorf("git credential fill gave no credentials for %s", redactURL(u))
+	}
+	r := http.Request{Header: make(http.Header)}
+	r.SetBasicAuth(username, password)
+	return prefix.String(), r.Header, nil
+}
+
+// netrcLine is a machine in a .netrc file
+type netrcLine struct {
+	machine  string
+	login    string
+	password string
+}
+
+var (
+	netrcOnce  sync.Once
+	netrcLines []netrcLine
+	netrcErr   error
+)
+
+// readNetrc reads the machines in NETRC, or the .netrc in the home directory, once.
+func readNetrc() ([]netrcLine, error) {
+	netrcOnce.Do(func() {
+		path, err := netrcPath()
+		if err != nil {
+			netrcErr = err
+			return
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				netrcErr = err
+			}
+			return
+		}
+		netrcLines = parseNetrc(string(b))
+	})
+	return netrcLines, netrcErr
+}
+
+func netrcPath() (string, error) {
+	if env := os.Getenv("NETRC"); env != "" {
+		return env, nil
+	}
+	dir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	if runtime.GOOS == "windows" {
+		legacy := filepath.Join(dir, "_netrc")
+		if _, err := os.Stat(legacy); err == nil {
+			return legacy, nil
+		}
+	}
+	return filepath.Join(dir, ".netrc"), nil
+}
+
+// parseNetrc parses a .netrc file, as the go command does: only machines with a login and password are used,
+// and nothing after a default entry.
+func parseNetrc(data string) []netrcLine {
+	var (
+		lines   []netrcLine
+		l       netrcLine
+		inMacro bool
+	)
+	for _, line := range strings.Split(data, "\n") {
+		if inMacro {
+			if line == "" {
+				inMacro = false
+			}
+			continue
+		}
+		f := strings.Fields(line)
+		i := 0
+		for ; i < len(f)-1; i += 2 {
+			switch f[i] {
+			case "machine":
+				l = netrcLine{machine: f[i+1]}
+			case "login":
+				l.login = f[i+1]
+			case "password":
+				l.password = f[i+1]
+			case "macdef":
+				inMacro = true
+			}
+			if l.machine != "" && l.login != "" && l.password != "" {
+				lines = append(lines, l)
+				l = netrcLine{}
+			}
+		}
+		if i < len(f) && f[i] == "default" {
+			break
+		}
+	}
+	return lines
+}
+
+// redactURL returns u with any password replaced, for logging.
+func redactURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	return parsed.Redacted()
+}
@@ -0,0 +1,123 @@
+package pkg
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []netrcLine
+	}{
+		{
+			name: "one machine per line",
+			data: "machine a.example.com login alice password secret\nmachine b.example.com login bob password hunter2\n",
+			want: []netrcLine{
+				{machine: "a.example.com", login: "alice", password: "secret"},
+				{machine: "b.example.com", login: "bob", password: "hunter2"},
+			},
+		},
+		{
+			name: "machine across lines",
+			data: "machine a.example.com\n\tlogin alice\n\tpassword secret\n",
+			want: []netrcLine{{machine: "a.example.com", login: "alice", password: "secret"}},
+		},
+		{
+			name: "machine without a password is ignored",
+			data: "machine a.example.com login alice\nmachine b.example.com login bob password hunter2\n",
+			want: []netrcLine{{machine: "b.example.com", login: "bob", password: "hunter2"}},
+		},
+		{
+			name: "macro definitions are skipped up to the blank line",
+			data: "macdef init\nmachine a.example.com login alice password secret\n\nmachine b.example.com login bob password hunter2\n",
+			want: []netrcLine{{machine: "b.example.com", login: "bob", password: "hunter2"}},
+		},
+		{
+			name: "nothing after default is read",
+			data: "machine a.example.com login alice password secret\ndefault\nmachine b.example.com login bob password hunter2\n",
+			want: []netrcLine{{machine: "a.example.com", login: "alice", password: "secret"}},
+		},
+		{
+			name: "empty",
+			data: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseNetrc(tt.data); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseNetrc() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAuthOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]http.Header
+		wantErr bool
+	}{
+		{
+			name: "one set for several URLs",
+			data: "https://a.example.com\nhttps://b.example.com/path\n\nAuthorization: Bearer token\n\n",
+			want: map[string]http.Header{
+				"a.example.com":      {"Authorization": {"Bearer token"}},
+				"b.example.com/path": {"Authorization": {"Bearer token"}},
+			},
+		},
+		{
+			name: "several sets",
+			data: "https://a.example.com\n\nAuthorization: Basic YTpi\nX-Extra: one\nX-Extra: two\n\n" +
+				"https://b.example.com\n\nAuthorization: Bearer token\n\n",
+			want: map[string]http.Header{
+				"a.example.com": {"Authorization": {"Basic YTpi"}, "X-Extra": {"one", "two"}},
+				"b.example.com": {"Authorization": {"Bearer token"}},
+			},
+		},
+		{
+			name: "no headers",
+			data: "https://a.example.com\n\n\n",
+			want: map[string]http.Header{"a.example.com": {}},
+		},
+		{
+			name: "empty",
+			data: "",
+			want: map[string]http.Header{},
+		},
+		{
+			name:    "missing empty line after URLs",
+			data:    "https://a.example.com\n",
+			wantErr: true,
+		},
+		{
+			name:    "missing empty line after headers",
+			data:    "https://a.example.com\n\nAuthorization: Bearer token\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid URL",
+			data:    "a.example.com\n\nAuthorization: Bearer token\n\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid header line",
+			data:    "https://a.example.com\n\nAuthorization Bearer token\n\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAuthOutput(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAuthOutput() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAuthOutput() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package pkg
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// goEnv returns the value of a go environment variable, as the go command would see it: from the environment,
+// or else from the go env file written by `go env -w`.
+func goEnv(key string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	envFile := os.Getenv("GOENV")
+	if envFile == "off" {
+		return ""
+	}
+	if envFile == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return ""
+		}
+		envFile = filepath.Join(dir, "go", "env")
+	}
+	b, err := os.ReadFile(envFile)
+	if err != nil {
+		return ""
+	}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		k, v, ok := strings.Cut(strings.TrimSpace(sc.Text()), "=")
+		if ok && strings.TrimSpace(k) == key {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// ModCacheDir returns the root of the go module cache: GOMODCACHE if set, else pkg/mod in the first entry of
+// GOPATH, which itself defaults to go in the home directory.
+func ModCacheDir() string {
+	if dir := goEnv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	goPath := goEnv("GOPATH")
+	if goPath != "" {
+		goPath = filepath.SplitList(goPath)[0]
+	} else {
+		home, err := os.UserHomeDir()
+		if err != nil || home == "" {
+			return ""
+		}
+		goPath = filepath.Join(home, "go")
+		// the go command ignores the default if it is actually GOROOT
+		if goPath == runtime.GOROOT() {
+			return ""
+		}
+	}
+	return filepath.Join(goPath, "pkg", "mod")
+}
+
+// localModule returns the module from the local module cache, or nil if it is not there. The original zip
+// in cache/download is preferred, so that the contents are identical to the proxy; the extracted module
+// directory is used only if the zip is missing. The zip is read from its file, so must be closed once done.
+func localModule(modPath, escPath, escVersion string) fs.FS {
+	cacheDir := ModCacheDir()
+	if cacheDir == "" {
+		return nil
+	}
+
+	zipPath := filepath.Join(cacheDir, "cache", "download", filepath.FromSlash(escPath), "@v", fmt.Sprintf("%s.zip", escVersion))
+	if _, err := os.Stat(zipPath); err == nil {
+		zr, err := zip.OpenReader(zipPath)
+		if err == nil {
+			log.Debugf("found module %s locally at %s", modPath, zipPath)
+			return zr
+		}
+		log.Warnf("ignoring invalid module zip %s: %v", zipPath, err)
+	}
+
+	dir := filepath.Join(cacheDir, filepath.FromSlash(escPath)+"@"+escVersion)
+	if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+		modFS := os.DirFS(dir)
+		// without go.mod, we cannot be sure it is complete, so fall back to the proxy
+		if _, err := fs.Stat(modFS, "go.mod"); err == nil {
+			log.Debugf("found module %s locally at %s", modPath, dir)
+			return modFS
+		}
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	modzip "golang.org/x/mod/zip"
+)
+
+// repoRoot describes the version control repository that hosts a module,
+// as declared by a go-import meta tag.
+type repoRoot struct {
+	root string // import path of the root of the repository
+	vcs  string
+	url  string
+}
+
+// knownHosts are hosted version control services whose repositories are always at host/owner/repo,
+// so there is no need to ask them for go-import meta tags.
+var knownHosts = map[string]bool{
+	"github.com":    true,
+	"bitbucket.org": true,
+}
+
+// resolveRepo finds the repository hosting the given module path, either from the known hosts,
+// or by asking the server for its go-import meta tags.
+func resolveRepo(ctx context.Context, modPath string) (*repoRoot, error) {
+	parts := strings.Split(modPath, "/")
+	if knownHosts[parts[0]] {
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("invalid module path %s for host %s", modPath, parts[0])
+		}
+		root := strings.Join(parts[:3], "/")
+		return &repoRoot{root: root, vcs: "git", url: "https://" + root}, nil
+	}
+
+	u := fmt.Sprintf("https://%s?go-get=1", modPath)
+	_, body, err := httpGet(ctx, u)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get go-import meta tags: %v", err)
+	}
+	imports, err := parseMetaGoImports(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse go-import meta tags from %s: %v", u, err)
+	}
+	var found *repoRoot
+	for i, imp := range imports {
+		if modPath != imp.root && !strings.HasPrefix(modPath, imp.root+"/") {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("multiple go-import meta tags at %s match %s", u, modPath)
+		}
+		found = &imports[i]
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no go-import meta tag at %s matches %s: %w", u, modPath, fs.ErrNotExist)
+	}
+	if found.vcs != "git" {
+		return nil, fmt.Errorf("unsupported version control system %s for %s", found.vcs, modPath)
+	}
+	return found, nil
+}
+
+// parseMetaGoImports returns the go-import meta tags in the head of an html document.
+func parseMetaGoImports(r io.Reader) (imports []repoRoot, err error) {
+	d := xml.NewDecoder(r)
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		switch strings.ToLower(charset) {
+		case "utf-8", "ascii":
+			return input, nil
+		default:
+			return nil, fmt.Errorf("can't decode charset %q", charset)
+		}
+	}
+	for {
+		t, err := d.RawToken()
+		if err != nil {
+			if err == io.EOF || len(imports) > 0 {
+				return imports, nil
+			}
+			return nil, err
+		}
+		if e, ok := t.(xml.StartElement); ok && strings.EqualFold(e.Name.Local, "body") {
+			return imports, nil
+		}
+		if e, ok := t.(xml.EndElement); ok && strings.EqualFold(e.Name.Local, "head") {
+			return imports, nil
+		}
+		e, ok := t.(xml.StartElement)
+		if !ok || !strings.EqualFold(e.Name.Local, "meta") {
+			continue
+		}
+		var name, content string
+		for _, a := range e.Attr {
+			switch a.Name.Local {
+			case "name":
+				name = a.Value
+			case "content":
+				content = a.Value
+			}
+		}
+		if name != "go-import" {
+			continue
+		}
+		if f := strings.Fields(content); len(f) == 3 {
+			imports = append(imports, repoRoot{root: f[0], vcs: f[1], url: f[2]})
+		}
+	}
+}
+
+// tagPrefix returns the prefix for tags of the module within the repository. Modules in a subdirectory
+// of the repository are tagged with the subdirectory, e.g. sub/dir/v1.2.3, excluding any major version suffix.
+func (r *repoRoot) tagPrefix(modPath string) string {
+	prefix, _, _ := module.SplitPathVersion(modPath)
+	rel := strings.TrimPrefix(strings.TrimPrefix(prefix, r.root), "/")
+	if rel == "" {
+		return ""
+	}
+	return rel + "/"
+}
+
+// directVersions lists the versions of the module that are tagged in its repository.
+func directVersions(ctx context.Context, modPath string) ([]string, error) {
+	repo, err := resolveRepo(ctx, modPath)
+	if err != nil {
+		return nil, err
+	}
+	out, err := runGit(ctx, "", "ls-remote", "--tags", repo.url)
+	if err != nil {
+		return nil, err
+	}
+	_, pathMajor, _ := module.SplitPathVersion(modPath)
+	prefix := "refs/tags/" + repo.tagPrefix(modPath)
+	var versions []string
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 || !strings.HasPrefix(fields[1], prefix) || strings.HasSuffix(fields[1], "^{}") {
+			continue
+		}
+		v := strings.TrimPrefix(fields[1], prefix)
+		if !semver.IsValid(v) || v != semver.Canonical(v) || !module.MatchPathMajor(v, pathMajor) {
+			continue
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+// directCheckout is a version of a module fetched into a local git repository.
+type directCheckout struct {
+	dir    string // the local repository
+	ref    string // the ref of the version within the repository
+	subdir string // the directory of the module within the repository
+}
+
+func (c *directCheckout) Close() error {
+	return os.RemoveAll(c.dir)
+}
+
+// directFetch fetches the given version of the module from its repository into a new local repository,
+// which must be closed when done.
+func directFetch(ctx context.Context, modPath, version string) (*directCheckout, error) {
+	repo, err := resolveRepo(ctx, modPath)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "go-sources-and-licenses-")
+	if err != nil {
+		return nil, err
+	}
+	c := &directCheckout{dir: dir}
+
+	if _, err := runGit(ctx, dir, "init", "-q"); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if module.IsPseudoVersion(version) {
+		err = c.fetchRevision(ctx, repo, modPath, version)
+	} else {
+		err = c.fetchTag(ctx, repo, modPath, version)
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	// a major version may be kept in its own subdirectory, or on its own branch
+	c.subdir = strings.TrimSuffix(repo.tagPrefix(modPath), "/")
+	if _, pathMajor, _ := module.SplitPathVersion(modPath); pathMajor != "" {
+		majorDir := path.Join(c.subdir, strings.TrimPrefix(pathMajor, "/"))
+		if _, err := runGit(ctx, dir, "cat-file", "-e", c.ref+":"+path.Join(majorDir, "go.mod")); err == nil {
+			c.subdir = majorDir
+		}
+	}
+	return c, nil
+}
+
+// fetchTag fetches the tag for a version of the module.
+func (c *directCheckout) fetchTag(ctx context.Context, repo *repoRoot, modPath, version string) error {
+	tag := repo.tagPrefix(modPath) + strings.TrimSuffix(version, "+incompatible")
+	c.ref = "refs/tags/" + tag
+	log.Debugf("fetching %s %s from %s", modPath, c.ref, repo.url)
+	if _, err := runGit(ctx, c.dir, "fetch", "-q", "--depth=1", repo.url, c.ref+":"+c.ref); err != nil {
+		if strings.Contains(err.Error(), "couldn't find remote ref") {
+			return fmt.Errorf("no tag %s in %s: %w", tag, repo.url, fs.ErrNotExist)
+		}
+		return err
+	}
+	return nil
+}
+
+// fetchRevision fetches the commit named by a pseudo-version of the module. Servers only hand out commits
+// by their full hash, so as with the go command, every branch and tag is fetched to find the short revision
+// among them. The commit must have been made at the time in the pseudo-version.
+func (c *directCheckout) fetchRevision(ctx context.Context, repo *repoRoot, modPath, version string) error {
+	rev, err := module.PseudoVersionRev(version)
+	if err != nil {
+		return err
+	}
+	vcsTime, err := module.PseudoVersionTime(version)
+	if err != nil {
+		return err
+	}
+	log.Debugf("fetching %s revision %s from %s", modPath, rev, repo.url)
+	if _, err := runGit(ctx, c.dir, "fetch", "-q", repo.url, "refs/heads/*:refs/remotes/origin/*", "refs/tags/*:refs/tags/*"); err != nil {
+		return err
+	}
+	out, err := runGit(ctx, c.dir, "rev-parse", "--verify", "-q", rev+"^{commit}")
+	if err != nil || !strings.HasPrefix(strings.TrimSpace(string(out)), rev) {
+		return fmt.Errorf("no revision %s in %s: %w", rev, repo.url, fs.ErrNotExist)
+	}
+	c.ref = strings.TrimSpace(string(out))
+	out, err = runGit(ctx, c.dir, "show", "-s", "--format=%ct", c.ref)
+	if err != nil {
+		return err
+	}
+	secs, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid commit time for %s in %s: %v", rev, repo.url, err)
+	}
+	if committed := time.Unix(secs, 0).UTC(); !committed.Equal(vcsTime) {
+		return fmt.Errorf("pseudo-version %s does not match revision %s committed at %s", version, rev, committed.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// directZip writes the module zip for the given version to w, creating it directly from its repository.
+func directZip(ctx context.Context, modPath, version string, w io.Writer) error {
+	c, err := directFetch(ctx, modPath, version)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	return modzip.CreateFromVCS(w, module.Version{Path: modPath, Version: version}, c.dir, c.ref, c.subdir)
+}
+
+// directMod returns the go.mod for the given version directly from its repository. As with the go command,
+// a module without a go.mod gets one that only declares the module path.
+func directMod(ctx context.Context, modPath, version string) ([]byte, error) {
+	c, err := directFetch(ctx, modPath, version)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	b, err := runGit(ctx, c.dir, "cat-file", "blob", c.ref+":"+path.Join(c.subdir, "go.mod"))
+	if err != nil {
+		return []byte(fmt.Sprintf("module %s\n", modPath)), nil
+	}
+	return b, nil
+}
+
+// runGit runs git with the given arguments in dir, returning its output. It is killed if ctx is done.
+func runGit(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	git, err := exec.LookPath("git")
+	if err != nil {
+		return nil, fmt.Errorf("git is required to fetch modules directly: %v", err)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, git, args...)
+	cmd.Dir = dir
+	// never prompt for credentials, we are not interactive
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,54 @@
+package pkg
+
+import (
+	"io"
+	"io/fs"
+	"path"
+)
+
+// filteredFS is a file system without some of its files or directories. A hidden directory hides everything in it.
+type filteredFS struct {
+	fs.FS
+	hide   func(name string) bool
+	closer io.Closer // closes the file system beneath, if it needs closing
+}
+
+func (f *filteredFS) Close() error {
+	if f.closer == nil {
+		return nil
+	}
+	return f.closer.Close()
+}
+
+func (f *filteredFS) isHidden(name string) bool {
+	for p := name; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		if f.hide(p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *filteredFS) Open(name string) (fs.File, error) {
+	if f.isHidden(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return f.FS.Open(name)
+}
+
+func (f *filteredFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if f.isHidden(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	entries, err := fs.ReadDir(f.FS, name)
+	if err != nil {
+		return nil, err
+	}
+	var visible []fs.DirEntry
+	for _, e := range entries {
+		if !f.isHidden(path.Join(name, e.Name())) {
+			visible = append(visible, e)
+		}
+	}
+	return visible, nil
+}
@@ -0,0 +1,79 @@
+package pkg
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// ErrHashMismatch is returned when the contents of a module do not match its expected hash.
+type ErrHashMismatch struct {
+	Module   string
+	Version  string
+	Expected string
+	Actual   string
+}
+
+func (e ErrHashMismatch) Error() string {
+	return fmt.Sprintf("hash mismatch for %s@%s: expected %s, got %s", e.Module, e.Version, e.Expected, e.Actual)
+}
+
+// HashModule calculates the h1: hash of the module contents, the same as is recorded in go.sum.
+// fsys is either a module zip, whose files already are under module@version, or a directory
+// holding the module contents at its root.
+func HashModule(fsys fs.FS, modPath, version string) (string, error) {
+	if zr, ok := ZipReader(fsys); ok {
+		var files []string
+		zfiles := make(map[string]*zip.File)
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			files = append(files, f.Name)
+			zfiles[f.Name] = f
+		}
+		return dirhash.Hash1(files, func(name string) (io.ReadCloser, error) {
+			f, ok := zfiles[name]
+			if !ok {
+				return nil, fs.ErrNotExist
+			}
+			return f.Open()
+		})
+	}
+
+	prefix := fmt.Sprintf("%s@%s", modPath, version)
+	var files []string
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		files = append(files, path.Join(prefix, p))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return dirhash.Hash1(files, func(name string) (io.ReadCloser, error) {
+		return fsys.Open(name[len(prefix)+1:])
+	})
+}
+
+// VerifyModule checks the contents of the module against the expected h1: hash, returning the actual hash.
+// If the contents do not match, the error is ErrHashMismatch.
+func VerifyModule(fsys fs.FS, modPath, version, expected string) (string, error) {
+	actual, err := HashModule(fsys, modPath, version)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash %s@%s: %v", modPath, version, err)
+	}
+	if actual != expected {
+		return actual, ErrHashMismatch{Module: modPath, Version: version, Expected: expected, Actual: actual}
+	}
+	return actual, nil
+}
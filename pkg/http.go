@@ -0,0 +1,192 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultHTTPTimeout is the default time allowed for each HTTP request, including reading the response
+	DefaultHTTPTimeout = 5 * time.Minute
+	// DefaultHTTPRetries is the default number of times a failed HTTP request is retried
+	DefaultHTTPRetries = 3
+
+	retryInitialBackoff = 500 * time.Millisecond
+	retryMaxBackoff     = 30 * time.Second
+	// a server asking for longer than this in Retry-After is asked again sooner
+	retryMaxAfter = time.Minute
+)
+
+// HTTPOptions configure the client shared by every request to proxies, checksum databases and go-import lookups
+type HTTPOptions struct {
+	Timeout time.Duration // time allowed for each attempt at a request, including reading the response; 0 for none
+	Retries int           // times to retry a request after a network error, 429 or 5xx response
+}
+
+var (
+	httpMu      sync.Mutex
+	httpOptions = HTTPOptions{Timeout: DefaultHTTPTimeout, Retries: DefaultHTTPRetries}
+	httpClient  = &http.Client{}
+)
+
+// SetHTTPOptions configures the client used for all HTTP requests.
+func SetHTTPOptions(opts HTTPOptions) {
+	httpMu.Lock()
+	defer httpMu.Unlock()
+	httpOptions = opts
+}
+
+// httpGet retrieves u, retrying with exponential backoff after network errors, 429 and 5xx responses, and
+// waiting as long as the server asks in Retry-After, within reason. The body of the final response is read in
+// full, so that the timeout covers it, and returned along with the response, whose body is closed.
+// Only ctx being done stops the retries early.
+func httpGet(ctx context.Context, u string) (*http.Response, []byte, error) {
+	return httpGetFile(ctx, u, nil, 0)
+}
+
+// httpGetFile retrieves u as httpGet does, except that if f is not nil, the body of a successful response is
+// written to f, emptied before each attempt, rather than held in memory. A body larger than maxSize is an error
+// that is not retried. The bodies of other responses are small, and still returned.
+func httpGetFile(ctx context.Context, u string, f *os.File, maxSize int64) (*http.Response, []byte, error) {
+	httpMu.Lock()
+	opts := httpOptions
+	httpMu.Unlock()
+
+	backoff := retryInitialBackoff
+	for attempt := 0; ; attempt++ {
+		resp, body, err := httpAttempt(ctx, u, opts.Timeout, f, maxSize)
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		retryable := err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		if errors.Is(err, errTooLarge) {
+			retryable = false
+		}
+		if !retryable || attempt >= opts.Retries {
+			return resp, body, err
+		}
+
+		wait := backoff + time.Duration(rand.Int63n(int64(backoff)/2+1))
+		if resp != nil {
+			if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				wait = after
+			}
+			log.Debugf("retrying %s in %s after %s", redactURL(u), wait, resp.Status)
+		} else {
+			log.Debugf("retrying %s in %s after %v", redactURL(u), wait, err)
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, nil, ctx.Err()
+		case <-t.C:
+		}
+		if backoff *= 2; backoff > retryMaxBackoff {
+			backoff = retryMaxBackoff
+		}
+	}
+}
+
+// httpAttempt makes a single attempt at retrieving u, within the timeout. As with the go command, if the server
+// refuses the request with a 4xx response, the GOAUTH commands are asked for new credentials for u, and if they
+// give any, the request is made once more with them.
+func httpAttempt(ctx context.Context, u string, timeout time.Duration, f *os.File, maxSize int64) (*http.Response, []byte, error) {
+	resp, body, err := httpDo(ctx, u, timeout, f, maxSize)
+	if err == nil && resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests &&
+		auth.refresh(ctx, u, resp) {
+		log.Debugf("retrying %s with new credentials after %s", redactURL(u), resp.Status)
+		return httpDo(ctx, u, timeout, f, maxSize)
+	}
+	return resp, body, err
+}
+
+// httpDo retrieves u, with any credentials for it, within the timeout, writing the body of a successful
+// response to f, if it is not nil.
+func httpDo(ctx context.Context, u string, timeout time.Duration, f *os.File, maxSize int64) (*http.Response, []byte, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	auth.addCredentials(ctx, req)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if f != nil && resp.StatusCode == http.StatusOK {
+		if err := copyToFile(f, resp.Body, maxSize); err != nil {
+			return nil, nil, fmt.Errorf("failed to read response from %s: %w", redactURL(u), err)
+		}
+		return resp, nil, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response from %s: %v", redactURL(u), err)
+	}
+	return resp, body, nil
+}
+
+// copyToFile replaces the contents of f with r, which must be no larger than maxSize, if it is positive.
+func copyToFile(f *os.File, r io.Reader, maxSize int64) error {
+	if err := resetFile(f); err != nil {
+		return err
+	}
+	if maxSize > 0 {
+		r = io.LimitReader(r, maxSize+1)
+	}
+	n, err := io.Copy(f, r)
+	if err != nil {
+		return err
+	}
+	if maxSize > 0 && n > maxSize {
+		return fmt.Errorf("larger than %d bytes: %w", maxSize, errTooLarge)
+	}
+	return nil
+}
+
+// resetFile empties f, ready to be written again.
+func resetFile(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.Seek(0, io.SeekStart)
+	return err
+}
+
+// retryAfter parses a Retry-After header, either a number of seconds or an HTTP date, capped at retryMaxAfter.
+func retryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	var d time.Duration
+	if secs, err := strconv.Atoi(header); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(header); err == nil {
+		d = time.Until(t)
+	} else {
+		return 0, false
+	}
+	if d < 0 {
+		d = 0
+	}
+	if d > retryMaxAfter {
+		d = retryMaxAfter
+	}
+	return d, true
+}
@@ -0,0 +1,378 @@
+package pkg
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+
+	mediaTypeOCIIndex    = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerList  = "application/vnd.docker.distribution.manifest.list.v2+json"
+	ociLayoutFile        = "oci-layout"
+	ociIndexFile         = "index.json"
+	dockerManifestFile   = "manifest.json"
+	defaultImagePlatform = "linux/amd64"
+)
+
+// executableMagic are the leading bytes of the executable formats that go can build: ELF, PE, Mach-O and XCOFF.
+var executableMagic = [][]byte{
+	[]byte("\x7FELF"),
+	[]byte("MZ"),
+	[]byte("\xFE\xED\xFA\xCE"),
+	[]byte("\xFE\xED\xFA\xCF"),
+	[]byte("\xCE\xFA\xED\xFE"),
+	[]byte("\xCF\xFA\xED\xFE"),
+	[]byte("\x01\xDF"),
+	[]byte("\x01\xF7"),
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Platform  *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+	} `json:"platform,omitempty"`
+}
+
+type ociIndex struct {
+	MediaType string          `json:"mediaType"`
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+type ociManifest struct {
+	Layers []ociDescriptor `json:"layers"`
+}
+
+type dockerManifest struct {
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// imageSource gives access to the files of an image, whether in a directory or a tar archive.
+type imageSource interface {
+	open(name string) (io.ReadCloser, error)
+}
+
+type dirImageSource string
+
+func (d dirImageSource) open(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+// tarImageSource is an image saved as a tar archive. The archive is read from the start to find each file,
+// as images have only a handful of files.
+type tarImageSource string
+
+func (t tarImageSource) open(name string) (io.ReadCloser, error) {
+	f, err := os.Open(string(t))
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			f.Close()
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("no %s in %s: %w", name, t, os.ErrNotExist)
+			}
+			return nil, err
+		}
+		if path.Clean(strings.TrimPrefix(hdr.Name, "./")) == name {
+			return readCloser{Reader: tr, Closer: f}, nil
+		}
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// layerFile is the layer that provides a file of the image, and the name in that layer of the regular file
+// with its contents, which differs from the path of the file if it is a hard link.
+type layerFile struct {
+	layer int
+	name  string
+}
+
+// ScanImage finds the executables in a container image, which is either an OCI image layout directory, or a tar
+// archive of one, as written by docker save. The layers of the image are applied in order, including whiteouts,
+// and f is called with the path and contents of every executable file in the resulting filesystem, including
+// those that are hard links. Files larger than maxSize are skipped, unless maxSize is 0.
+// If the image has manifests for several platforms, the one for linux/amd64 is used, or else the first.
+func ScanImage(image string, maxSize int64, f func(p string, r io.ReaderAt) error) error {
+	fi, err := os.Stat(image)
+	if err != nil {
+		return err
+	}
+	var src imageSource = tarImageSource(image)
+	if fi.IsDir() {
+		src = dirImageSource(image)
+	}
+	layers, err := imageLayers(src)
+	if err != nil {
+		return fmt.Errorf("failed to read image %s: %v", image, err)
+	}
+
+	// first find which layer provides each file of the final filesystem
+	owner := make(map[string]layerFile)
+	for i, layer := range layers {
+		var entries []*tar.Header
+		if err := readLayer(src, layer, func(hdr *tar.Header, _ io.Reader) error {
+			entries = append(entries, hdr)
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to read layer %s: %v", layer, err)
+		}
+		// whiteouts remove files from the layers below, so apply them before adding the files of this layer
+		for _, hdr := range entries {
+			dir, base := path.Split(layerPath(hdr.Name))
+			dir = strings.TrimSuffix(dir, "/")
+			switch {
+			case base == whiteoutOpaque:
+				removeTree(owner, dir, true)
+			case strings.HasPrefix(base, whiteoutPrefix):
+				removeTree(owner, path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)), false)
+			}
+		}
+		for _, hdr := range entries {
+			p := layerPath(hdr.Name)
+			if strings.HasPrefix(path.Base(p), whiteoutPrefix) {
+				continue
+			}
+			// anything other than a directory replaces a directory from the layers below, with all that is in it
+			if hdr.Typeflag != tar.TypeDir {
+				removeTree(owner, p, true)
+			}
+			switch hdr.Typeflag {
+			case tar.TypeReg:
+				owner[p] = layerFile{layer: i, name: p}
+			case tar.TypeLink:
+				// a hard link has the contents of an earlier file in the same layer
+				owner[p] = layerFile{layer: i, name: layerPath(hdr.Linkname)}
+			default:
+				// directories, symlinks and the like replace a file from the layers below, but are not scanned
+				delete(owner, p)
+			}
+		}
+	}
+
+	// the paths of the files of the final filesystem provided by each regular file of each layer
+	paths := make([]map[string][]string, len(layers))
+	for p, lf := range owner {
+		if paths[lf.layer] == nil {
+			paths[lf.layer] = make(map[string][]string)
+		}
+		paths[lf.layer][lf.name] = append(paths[lf.layer][lf.name], p)
+	}
+
+	// then read each executable from the layer that provides it
+	for i, layer := range layers {
+		if len(paths[i]) == 0 {
+			continue
+		}
+		err := readLayer(src, layer, func(hdr *tar.Header, r io.Reader) error {
+			ps := paths[i][layerPath(hdr.Name)]
+			if len(ps) == 0 || hdr.Typeflag != tar.TypeReg {
+				return nil
+			}
+			br := bufio.NewReader(r)
+			if head, _ := br.Peek(4); !hasExecutableMagic(head) {
+				return nil
+			}
+			sort.Strings(ps)
+			if maxSize > 0 && hdr.Size > maxSize {
+				log.Warnf("skipping %s in image %s, which is larger than %d bytes", "/"+ps[0], image, maxSize)
+				return nil
+			}
+			ra, _, cleanup, err := spool(br, maxSize)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+			for _, p := range ps {
+				if err := f("/"+p, ra); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read layer %s: %v", layer, err)
+		}
+	}
+	return nil
+}
+
+// imageLayers returns the names of the layers of the image in src, lowest first.
+func imageLayers(src imageSource) ([]string, error) {
+	// docker save writes a manifest.json, newer versions as well as an OCI layout
+	if b, err := readImageFile(src, dockerManifestFile); err == nil {
+		var manifests []dockerManifest
+		if err := json.Unmarshal(b, &manifests); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", dockerManifestFile, err)
+		}
+		if len(manifests) == 0 {
+			return nil, fmt.Errorf("no images in %s", dockerManifestFile)
+		}
+		if len(manifests) > 1 {
+			log.Warnf("image archive has %d images, only scanning the first, %v", len(manifests), manifests[0].RepoTags)
+		}
+		return manifests[0].Layers, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if _, err := readImageFile(src, ociLayoutFile); err != nil {
+		return nil, fmt.Errorf("neither an OCI image layout nor a docker image archive: %v", err)
+	}
+	b, err := readImageFile(src, ociIndexFile)
+	if err != nil {
+		return nil, err
+	}
+	var index ociIndex
+	if err := json.Unmarshal(b, &index); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", ociIndexFile, err)
+	}
+	desc, err := selectManifest(index.Manifests)
+	if err != nil {
+		return nil, err
+	}
+	// an index may point to further indexes, one for each image
+	for desc.MediaType == mediaTypeOCIIndex || desc.MediaType == mediaTypeDockerList {
+		if b, err = readImageFile(src, blobPath(desc.Digest)); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &index); err != nil {
+			return nil, fmt.Errorf("invalid image index %s: %v", desc.Digest, err)
+		}
+		if desc, err = selectManifest(index.Manifests); err != nil {
+			return nil, err
+		}
+	}
+	if b, err = readImageFile(src, blobPath(desc.Digest)); err != nil {
+		return nil, err
+	}
+	var manifest ociManifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid image manifest %s: %v", desc.Digest, err)
+	}
+	var layers []string
+	for _, l := range manifest.Layers {
+		layers = append(layers, blobPath(l.Digest))
+	}
+	return layers, nil
+}
+
+// selectManifest picks the manifest for the default platform, or else the first.
+func selectManifest(manifests []ociDescriptor) (ociDescriptor, error) {
+	if len(manifests) == 0 {
+		return ociDescriptor{}, fmt.Errorf("image index has no manifests")
+	}
+	for _, m := range manifests {
+		if m.Platform != nil && m.Platform.OS+"/"+m.Platform.Architecture == defaultImagePlatform {
+			return m, nil
+		}
+	}
+	return manifests[0], nil
+}
+
+// blobPath returns the path of the blob with the given digest in an OCI image layout.
+func blobPath(digest string) string {
+	alg, hex, _ := strings.Cut(digest, ":")
+	return path.Join("blobs", alg, hex)
+}
+
+func readImageFile(src imageSource, name string) ([]byte, error) {
+	r, err := src.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// readLayer calls f with each entry in the layer, which may be compressed with gzip.
+func readLayer(src imageSource, layer string, f func(hdr *tar.Header, r io.Reader) error) error {
+	rc, err := src.open(layer)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	br := bufio.NewReader(rc)
+	var r io.Reader = br
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return fmt.Errorf("zstd compressed layers are not supported")
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := f(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// layerPath returns the cleaned path of a file in a layer, relative to the root.
+func layerPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// removeTree removes p and everything under it from the files, or only what is under it if childrenOnly is true.
+func removeTree(files map[string]layerFile, p string, childrenOnly bool) {
+	if !childrenOnly {
+		delete(files, p)
+	}
+	prefix := p + "/"
+	if p == "" {
+		prefix = ""
+	}
+	for f := range files {
+		if strings.HasPrefix(f, prefix) {
+			delete(files, f)
+		}
+	}
+}
+
+// hasExecutableMagic reports whether head, the start of a file, is the magic number of an executable format.
+func hasExecutableMagic(head []byte) bool {
+	for _, m := range executableMagic {
+		if bytes.HasPrefix(head, m) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package pkg
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// layerEntry is an entry of a layer tar: a regular file with contents, a directory if its name ends with a slash,
+// or a hard link if link is set.
+type layerEntry struct {
+	name     string
+	contents string
+	link     string
+}
+
+func writeTar(t *testing.T, w io.Writer, entries []layerEntry) {
+	t.Helper()
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o755, Typeflag: tar.TypeReg, Size: int64(len(e.contents))}
+		switch {
+		case e.link != "":
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeLink, e.link, 0
+		case e.name[len(e.name)-1] == '/':
+			hdr.Typeflag, hdr.Size = tar.TypeDir, 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size > 0 {
+			if _, err := tw.Write([]byte(e.contents)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeDockerImage writes an image archive in the format of docker save, with the given layers, lowest first.
+func writeDockerImage(t *testing.T, layers ...[]layerEntry) string {
+	t.Helper()
+	var entries []layerEntry
+	var names []string
+	for i, l := range layers {
+		var buf bytes.Buffer
+		writeTar(t, &buf, l)
+		name := filepath.ToSlash(filepath.Join("layers", string(rune('a'+i)), "layer.tar"))
+		names = append(names, name)
+		entries = append(entries, layerEntry{name: name, contents: buf.String()})
+	}
+	manifest, err := json.Marshal([]dockerManifest{{RepoTags: []string{"example:latest"}, Layers: names}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries = append(entries, layerEntry{name: dockerManifestFile, contents: string(manifest)})
+	p := filepath.Join(t.TempDir(), "image.tar")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	writeTar(t, f, entries)
+	return p
+}
+
+func TestScanImage(t *testing.T) {
+	const elf = "\x7FELF"
+	image := writeDockerImage(t,
+		[]layerEntry{
+			{name: "bin/"},
+			{name: "bin/deleted", contents: elf + "deleted"},
+			{name: "bin/kept", contents: elf + "kept"},
+			{name: "bin/link", link: "bin/deleted"},
+			{name: "bin/script", contents: "#!/bin/sh\n"},
+			{name: "opaque/"},
+			{name: "opaque/old", contents: elf + "old"},
+			{name: "replaced/"},
+			{name: "replaced/child", contents: elf + "child"},
+			{name: "big", contents: elf + "this is too large"},
+		},
+		[]layerEntry{
+			{name: "bin/.wh.deleted"},
+			{name: "opaque/.wh..wh..opq"},
+			{name: "opaque/new", contents: elf + "new"},
+			{name: "replaced", contents: "a file now"},
+			{name: "bin/kept", contents: elf + "upper"},
+		},
+	)
+
+	got := make(map[string]string)
+	err := ScanImage(image, 16, func(p string, r io.ReaderAt) error {
+		b, err := io.ReadAll(io.NewSectionReader(r, 0, 1<<20))
+		if err != nil {
+			return err
+		}
+		got[p] = string(b)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ScanImage() error = %v", err)
+	}
+	want := map[string]string{
+		// the whiteout removes the file, but not the hard link to it
+		"/bin/link": elf + "deleted",
+		// the upper layer replaces the file
+		"/bin/kept": elf + "upper",
+		// the opaque whiteout removes everything below it from the lower layers
+		"/opaque/new": elf + "new",
+		// replaced/child went with the directory, big is over the size limit, and the script is not an executable
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ScanImage() found %v, want %v", got, want)
+	}
+}
@@ -2,6 +2,8 @@ package pkg
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"path/filepath"
 	"strings"
@@ -88,22 +90,26 @@ func licenseChecker(r io.ReadCloser, p string) io.ReadCloser {
 	var buf bytes.Buffer
 	tr := io.TeeReader(r, &buf)
 
-	return &licenseReader{Reader: tr, buf: &buf}
+	return &licenseReader{Reader: tr, buf: &buf, path: p}
 }
 
 type licenseReader struct {
 	io.Reader
 	buf      *bytes.Buffer
+	path     string
+	sum      string
 	licenses []string
 }
 
 func (l *licenseReader) Close() error {
 	// process the data
 	contents := l.buf.Bytes()
+	sum := sha256.Sum256(contents)
+	l.sum = hex.EncodeToString(sum[:])
 	cov := licensecheck.Scan(contents)
 
 	if cov.Percent < float64(coverageThreshold) {
-		l.licenses = append(l.licenses, unknownLicenseType)
+		l.licenses = append(l.licenses, UnknownLicenseType)
 	}
 	for _, m := range cov.Match {
 		l.licenses = append(l.licenses, m.ID)
@@ -1,179 +1,105 @@
 package pkg
 
 import (
-	"bufio"
 	"fmt"
 	"io"
-	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
 )
 
 type ModFile struct {
 	Name        string
+	Deprecated  string // deprecation message of the module, if it is deprecated
 	GoVersion   string
 	GoToolchain string
+	Godebug     map[string]string
 	Requires    []Package
+	Excludes    []Package
 	Replace     map[string]Package
+	Retracts    []VersionInterval
+	Tools       []string
 }
 
-func ParseMod(r io.Reader) (*ModFile, error) {
-	var m ModFile
-	m.Replace = map[string]Package{}
-	sc := bufio.NewScanner(r)
-	var inRequire, inReplace, inRetract bool
+// VersionInterval is a range of versions, inclusive of both ends. For a single version, Low and High are the same.
+type VersionInterval struct {
+	Low       string
+	High      string
+	Rationale string
+}
 
-	for sc.Scan() {
-		line := sc.Text()
-		// ignore comments
-		if strings.HasPrefix(line, "//") {
-			continue
-		}
-		parts := strings.Fields(line)
-		switch {
-		case len(parts) == 0:
-			continue
-		case parts[0] == "module":
-			if m.Name != "" {
-				return nil, fmt.Errorf("invalid go.mod: multiple module lines")
-			}
-			m.Name = parts[1]
-		case parts[0] == "go":
-			if m.GoVersion != "" {
-				return nil, fmt.Errorf("invalid go.mod: multiple go lines")
-			}
-			m.GoVersion = parts[1]
-		case parts[0] == "toolchain":
-			if m.GoToolchain != "" {
-				return nil, fmt.Errorf("invalid go.mod: multiple toolchain lines")
-			}
-			m.GoToolchain = parts[1]
-		case parts[0] == "require":
-			if inRequire {
-				return nil, fmt.Errorf("invalid go.mod: nested require blocks")
-			}
-			if len(parts) < 2 {
-				return nil, fmt.Errorf("invalid go.mod: standalone require on a line")
-			}
-			if parts[1] == "(" {
-				inRequire = true
-				continue
-			}
-			entry, err := requireEntry(parts[1:])
-			if err != nil {
-				return nil, err
-			}
-			m.Requires = append(m.Requires, entry)
-		case parts[0] == "replace":
-			if inReplace {
-				return nil, fmt.Errorf("invalid go.mod: nested replace blocks")
-			}
-			if len(parts) < 2 {
-				return nil, fmt.Errorf("invalid go.mod: standalone replace on a line")
-			}
-			if parts[1] == "(" {
-				inReplace = true
-				continue
-			}
-			old, replace, err := replaceEntry(parts[1:])
-			if err != nil {
-				return nil, err
-			}
-			m.Replace[old.String()] = replace
-		case parts[0] == "retract":
-			if inRetract {
-				return nil, fmt.Errorf("invalid go.mod: nested require blocks")
-			}
-			if len(parts) < 2 {
-				return nil, fmt.Errorf("invalid go.mod: standalone retract on a line")
-			}
-			if parts[1] == "(" {
-				inRetract = true
-				continue
-			}
-		case parts[0] == ")":
-			switch {
-			case inRequire:
-				inRequire = false
-			case inReplace:
-				inReplace = false
-			case inRetract:
-				inRetract = false
-			default:
-				return nil, fmt.Errorf("invalid go.mod: unexpected closing paren")
-			}
-		default:
-			// just a regular line
-			switch {
-			case inRequire:
-				entry, err := requireEntry(parts)
-				if err != nil {
-					return nil, err
-				}
-				m.Requires = append(m.Requires, entry)
-			case inReplace:
-				old, replace, err := replaceEntry(parts)
-				if err != nil {
-					return nil, err
-				}
-				m.Replace[old.String()] = replace
-			case inRetract:
-				// just ignore
-			default:
-				return nil, fmt.Errorf("invalid go.mod: unexpected line")
-			}
+// Retracted reports whether the version is retracted by the go.mod.
+func (m *ModFile) Retracted(version string) bool {
+	for _, r := range m.Retracts {
+		if semver.Compare(version, r.Low) >= 0 && semver.Compare(version, r.High) <= 0 {
+			return true
 		}
 	}
-	return &m, nil
+	return false
 }
 
-func requireEntry(line []string) (p Package, err error) {
-	if len(line) < 2 {
-		return Package{}, fmt.Errorf("invalid go.mod: standalone require on a line")
-	}
-	// strip any leading or trailing quotes
-	entry := Package{
-		Name:    strings.Trim(line[0], `"`),
-		Version: line[1],
-	}
-	if len(line) > 3 && strings.HasSuffix(line[len(line)-1], "indirect") {
-		entry.Indirect = true
+// Excluded reports whether the module version is excluded by the go.mod.
+func (m *ModFile) Excluded(p Package) bool {
+	for _, e := range m.Excludes {
+		if e.Name == p.Name && e.Version == p.Version {
+			return true
+		}
 	}
-	return entry, nil
+	return false
 }
 
-func replaceEntry(line []string) (old, new Package, err error) {
-	// potential structure of line:
-	// module-path [module-version] => replacement-path [replacement-version]
-	var (
-		preParts, postParts []string
-		inPre               = true
-	)
+// ParseMod parses a go.mod file, following the full go.mod grammar. Errors include the line on which they occur.
+func ParseMod(r io.Reader) (*ModFile, error) {
+	return parseMod(r, modfile.Parse)
+}
 
-	for _, part := range line {
-		if part == "=>" {
-			inPre = false
-			continue
-		}
-		if inPre {
-			preParts = append(preParts, part)
-		} else {
-			postParts = append(postParts, part)
-		}
+// ParseModLax parses the go.mod file of a dependency, as the go command does: unknown directives are ignored,
+// as are those that apply only to the main module, such as replace and exclude.
+func ParseModLax(r io.Reader) (*ModFile, error) {
+	return parseMod(r, modfile.ParseLax)
+}
+
+func parseMod(r io.Reader, parse func(file string, data []byte, fix modfile.VersionFixer) (*modfile.File, error)) (*ModFile, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read go.mod: %v", err)
 	}
-	if len(preParts) < 1 || len(postParts) < 1 {
-		return old, new, fmt.Errorf("invalid go.mod: invalid replace line")
+	f, err := parse("go.mod", b, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid go.mod: %v", err)
 	}
-	old = Package{
-		Name: strings.Trim(preParts[0], `"`),
+	m := ModFile{
+		Godebug: map[string]string{},
+		Replace: map[string]Package{},
 	}
-	new = Package{
-		Name: strings.Trim(postParts[0], `"`),
+	if f.Module != nil {
+		m.Name = f.Module.Mod.Path
+		m.Deprecated = f.Module.Deprecated
 	}
-
-	if len(preParts) > 1 {
-		old.Version = preParts[1]
+	if f.Go != nil {
+		m.GoVersion = f.Go.Version
+	}
+	if f.Toolchain != nil {
+		m.GoToolchain = f.Toolchain.Name
+	}
+	for _, g := range f.Godebug {
+		m.Godebug[g.Key] = g.Value
 	}
-	if len(postParts) > 1 {
-		new.Version = postParts[1]
+	for _, r := range f.Require {
+		m.Requires = append(m.Requires, Package{Name: r.Mod.Path, Version: r.Mod.Version, Indirect: r.Indirect})
 	}
-	return
+	for _, e := range f.Exclude {
+		m.Excludes = append(m.Excludes, Package{Name: e.Mod.Path, Version: e.Mod.Version})
+	}
+	for _, r := range f.Replace {
+		old := Package{Name: r.Old.Path, Version: r.Old.Version}
+		m.Replace[old.String()] = Package{Name: r.New.Path, Version: r.New.Version}
+	}
+	for _, r := range f.Retract {
+		m.Retracts = append(m.Retracts, VersionInterval{Low: r.Low, High: r.High, Rationale: r.Rationale})
+	}
+	for _, t := range f.Tool {
+		m.Tools = append(m.Tools, t.Path)
+	}
+	return &m, nil
 }
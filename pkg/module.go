@@ -4,91 +4,149 @@ import (
 	"archive/zip"
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/fs"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/google/licensecheck"
 	log "github.com/sirupsen/logrus"
+	modzip "golang.org/x/mod/zip"
 )
 
 const (
 	coverageThreshold  = 75
-	unknownLicenseType = "UNKNOWN"
+	UnknownLicenseType = "UNKNOWN"
 )
 
 // GetModule get the module from the proxy, or local cache if it exists.
 // If force is true, it will always get the module from the proxy.
 // If it cannot find the go.sum locally, will get it from the proxy.
-func GetModule(module, version, proxy string, force bool) (fs.FS, error) {
+// proxy is a list of proxies in the same format as GOPROXY, including "direct" and "off".
+// Modules matching GONOPROXY or GOPRIVATE are always retrieved directly from version control.
+// A module zip is read from a file rather than memory, however large, in which case the returned fs.FS
+// is an io.Closer, to be closed once done with it.
+func GetModule(ctx context.Context, module, version, proxy string, force bool) (fs.FS, error) {
 	if !strings.Contains(module, ".") {
 		return nil, fmt.Errorf("module must be a valid go module, does not support built in modules %s", module)
 	}
 	if version == "" {
 		log.Printf("getting latest version of %s", module)
-		versions, err := GetVersions(module, proxy)
+		latest, err := LatestVersion(ctx, module, proxy)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get versions: %v", err)
+			return nil, err
 		}
-		version = versions[len(versions)-1]
+		version = latest
+	}
+	escPath, escVersion, err := escapeModule(module, version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid module %s@%s: %v", module, version, err)
 	}
 	// first see if we have it locally
 	if !force {
-		goPath := os.Getenv("GOPATH")
-		if goPath != "" {
-			modPath := filepath.Join(goPath, "pkg", "mod", fmt.Sprintf("%s@%s", module, version))
-			if fi, err := os.Stat(modPath); err == nil && fi != nil && fi.IsDir() {
-				log.Debugf("found module %s locally at %s", module, modPath)
-				modFS := os.DirFS(modPath)
-				// did it have go.mod?
-				if _, err := modFS.Open("go.mod"); err == nil {
-					return modFS, nil
-				}
-				// did not have go.mod, so just fall back to getting it from the proxy
-			}
+		if fsys := localModule(module, escPath, escVersion); fsys != nil {
+			return fsys, nil
 		}
 	}
 
 	// we could not get it locally, or were told not to, so get it from the proxy
 
-	// get the module zip
-	u := fmt.Sprintf("%s/%s/@v/%s.zip", proxy, strings.ToLower(module), version)
-	resp, err := http.Get(u)
+	// get the module zip, spooled to a temporary file, no larger than the go command allows
+	tmp, err := os.CreateTemp("", "go-sources-and-licenses-*.zip")
 	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get module zip: %s", resp.Status)
+		return nil, fmt.Errorf("failed to create temporary file for module zip: %v", err)
 	}
-	// read the zip
-	b, err := io.ReadAll(resp.Body)
+	defer tmp.Close()
+	var r *moduleZip
+	err = tryProxies(ctx, proxyListFor(module, proxy), func(p string) error {
+		source := "version control"
+		if p == proxyDirect {
+			if err := resetFile(tmp); err != nil {
+				return err
+			}
+			if err := directZip(ctx, module, version, tmp); err != nil {
+				return err
+			}
+		} else {
+			source = redactURL(p)
+			if err := proxyDownload(ctx, p, fmt.Sprintf("%s/@v/%s.zip", escPath, escVersion), tmp, modzip.MaxZipFile); err != nil {
+				return err
+			}
+		}
+		zr, err := zip.OpenReader(tmp.Name())
+		if err != nil {
+			return fmt.Errorf("invalid module zip from %s: %v", source, err)
+		}
+		log.Debugf("found module %s via %s", module, source)
+		r = &moduleZip{ReadCloser: zr, temp: tmp.Name()}
+		return nil
+	})
 	if err != nil {
-		return nil, err
+		_ = os.Remove(tmp.Name())
+		return nil, fmt.Errorf("failed to get module zip: %w", err)
 	}
-	log.Debugf("found module %s via proxy", module)
-	return zip.NewReader(bytes.NewReader(b), resp.ContentLength)
+	return r, nil
 }
 
-func GetVersions(module, proxy string) ([]string, error) {
-	resp, err := http.Get(fmt.Sprintf("%s/%s/@v/list", proxy, module))
+// GetVersions lists the known versions of the module, from the first proxy in the GOPROXY list that has it.
+func GetVersions(ctx context.Context, module, proxy string) ([]string, error) {
+	escPath, _, err := escapeModule(module, "")
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid module %s: %v", module, err)
 	}
 	var versions []string
-	scanner := bufio.NewScanner(resp.Body)
-	for scanner.Scan() {
-		versions = append(versions, scanner.Text())
-	}
-	if err := scanner.Err(); err != nil {
+	err = tryProxies(ctx, proxyListFor(module, proxy), func(p string) error {
+		if p == proxyDirect {
+			v, err := directVersions(ctx, module)
+			if err != nil {
+				return err
+			}
+			versions = v
+			return nil
+		}
+		b, err := proxyGet(ctx, p, fmt.Sprintf("%s/@v/list", escPath))
+		if err != nil {
+			return err
+		}
+		versions = nil
+		scanner := bufio.NewScanner(bytes.NewReader(b))
+		for scanner.Scan() {
+			if v := strings.TrimSpace(scanner.Text()); v != "" {
+				versions = append(versions, v)
+			}
+		}
+		return scanner.Err()
+	})
+	if err != nil {
 		return nil, err
 	}
 	return versions, nil
+}
 
+// GetModFile retrieves the go.mod for the given version of the module, from the first proxy in the GOPROXY list
+// that has it.
+func GetModFile(ctx context.Context, module, version, proxy string) ([]byte, error) {
+	escPath, escVersion, err := escapeModule(module, version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid module %s@%s: %v", module, version, err)
+	}
+	var b []byte
+	err = tryProxies(ctx, proxyListFor(module, proxy), func(p string) error {
+		var err error
+		if p == proxyDirect {
+			b, err = directMod(ctx, module, version)
+		} else {
+			b, err = proxyGet(ctx, p, fmt.Sprintf("%s/@v/%s.mod", escPath, escVersion))
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
 }
 
 func FindLicenses(fsys fs.FS) []string {
@@ -129,7 +187,7 @@ func FindLicenses(fsys fs.FS) []string {
 		cov := licensecheck.Scan(contents)
 
 		if cov.Percent < float64(coverageThreshold) {
-			licenses = append(licenses, unknownLicenseType)
+			licenses = append(licenses, UnknownLicenseType)
 		}
 		for _, m := range cov.Match {
 			licenses = append(licenses, m.ID)
@@ -0,0 +1,129 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/mod/semver"
+)
+
+// prunedGoVersion is the first go version whose go.mod lists every module needed to build its packages,
+// allowing the module graph to be pruned.
+const prunedGoVersion = "v1.17"
+
+// BuildList computes the build list of the main module using minimal version selection, as the go command does:
+// the go.mod of every module in the requirement graph is retrieved from the proxy, and the highest version
+// of each module required anywhere in the graph is selected. As with the go command, when both the main module
+// and a dependency are at go 1.17 or later, the requirements of that dependency are included,
+// but not followed any further. Replacements and exclusions in the main module apply throughout the graph,
+// so an excluded module version is neither selected nor followed.
+// The returned packages are sorted by name, do not include the main module,
+// and are marked Indirect if the main module does not require them directly.
+func BuildList(ctx context.Context, main *ModFile, proxy string) ([]Package, error) {
+	var (
+		selected = make(map[string]string)
+		direct   = make(map[string]bool)
+		expanded = make(map[string]bool)
+		queue    []Package
+	)
+	pruned := isPruned(main.GoVersion)
+	require := func(p Package) bool {
+		// as with the go command, the main module is always itself, whatever version of it is required
+		if p.Name == main.Name {
+			return false
+		}
+		if main.Excluded(p) {
+			log.Debugf("ignoring requirement on %s, excluded by the main module", p)
+			return false
+		}
+		if v, ok := selected[p.Name]; !ok || semver.Compare(p.Version, v) > 0 {
+			selected[p.Name] = p.Version
+		}
+		return true
+	}
+	for _, p := range main.Requires {
+		if !require(p) {
+			continue
+		}
+		direct[p.Name] = true
+		queue = append(queue, p)
+	}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if expanded[p.String()] {
+			continue
+		}
+		expanded[p.String()] = true
+
+		mod, err := requiredModFile(ctx, main, p, proxy)
+		if err != nil {
+			return nil, err
+		}
+		if mod == nil {
+			continue
+		}
+		for _, r := range mod.Requires {
+			if !require(r) {
+				continue
+			}
+			if pruned && isPruned(mod.GoVersion) {
+				continue
+			}
+			queue = append(queue, r)
+		}
+	}
+
+	var list []Package
+	for name, version := range selected {
+		list = append(list, Package{Name: name, Version: version, Indirect: !direct[name]})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// requiredModFile retrieves and parses the go.mod of a module in the requirement graph, after applying any
+// replacement from the main module. Modules replaced by a local directory have no go.mod to retrieve,
+// and return nil.
+func requiredModFile(ctx context.Context, main *ModFile, p Package, proxy string) (*ModFile, error) {
+	target := p
+	if r, ok := main.Replace[p.String()]; ok {
+		target = r
+	} else if r, ok := main.Replace[p.Name]; ok {
+		target = r
+	}
+	if target.Version == "" {
+		log.Debugf("not following requirements of %s, replaced by local directory %s", p, target.Name)
+		return nil, nil
+	}
+	b, err := GetModFile(ctx, target.Name, target.Version, proxy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get go.mod for %s: %v", target, err)
+	}
+	mod, err := ParseModLax(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse go.mod for %s: %v", target, err)
+	}
+	return mod, nil
+}
+
+// isPruned reports whether a go.mod at the given go version has a pruned module graph.
+func isPruned(goVersion string) bool {
+	return goVersion != "" && semver.Compare(langVersion(goVersion), prunedGoVersion) >= 0
+}
+
+// langVersion returns the language version of a go version as a semantic version, e.g. v1.21 for 1.21, 1.21.3
+// or 1.21rc1. As with the go command, a release candidate of a language version already has its features.
+func langVersion(goVersion string) string {
+	if i := strings.IndexFunc(goVersion, func(r rune) bool { return r != '.' && (r < '0' || r > '9') }); i >= 0 {
+		goVersion = goVersion[:i]
+	}
+	if parts := strings.SplitN(goVersion, ".", 3); len(parts) == 3 {
+		goVersion = parts[0] + "." + parts[1]
+	}
+	return "v" + goVersion
+}
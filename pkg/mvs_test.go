@@ -0,0 +1,153 @@
+package pkg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeModProxy writes a file:// proxy holding the go.mod of each module@version in mods, and returns its URL.
+func writeModProxy(t *testing.T, mods map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for mv, mod := range mods {
+		modPath, version, _ := strings.Cut(mv, "@")
+		escPath, escVersion, err := escapeModule(modPath, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := filepath.Join(dir, filepath.FromSlash(escPath), "@v", escVersion+".mod")
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(mod), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return "file://" + filepath.ToSlash(dir)
+}
+
+func TestBuildList(t *testing.T) {
+	t.Setenv("GOENV", "off")
+	t.Setenv("GONOPROXY", "")
+	t.Setenv("GOPRIVATE", "")
+
+	tests := []struct {
+		name string
+		main string
+		mods map[string]string
+		want []Package
+	}{
+		{
+			name: "highest required version is selected",
+			main: "module example.com/main\ngo 1.16\nrequire (\n\texample.com/a v1.0.0\n\texample.com/b v1.0.0\n)\n",
+			mods: map[string]string{
+				"example.com/a@v1.0.0": "module example.com/a\n",
+				"example.com/a@v1.1.0": "module example.com/a\n",
+				"example.com/b@v1.0.0": "module example.com/b\nrequire example.com/a v1.1.0\n",
+			},
+			want: []Package{
+				{Name: "example.com/a", Version: "v1.1.0"},
+				{Name: "example.com/b", Version: "v1.0.0"},
+			},
+		},
+		{
+			name: "unpruned graph is followed throughout",
+			main: "module example.com/main\ngo 1.16\nrequire example.com/a v1.0.0\n",
+			mods: map[string]string{
+				"example.com/a@v1.0.0": "module example.com/a\ngo 1.17\nrequire example.com/c v1.0.0\n",
+				"example.com/c@v1.0.0": "module example.com/c\ngo 1.17\nrequire example.com/d v1.0.0\n",
+				"example.com/d@v1.0.0": "module example.com/d\n",
+			},
+			want: []Package{
+				{Name: "example.com/a", Version: "v1.0.0"},
+				{Name: "example.com/c", Version: "v1.0.0", Indirect: true},
+				{Name: "example.com/d", Version: "v1.0.0", Indirect: true},
+			},
+		},
+		{
+			name: "pruned dependencies are included but not followed",
+			main: "module example.com/main\ngo 1.21\nrequire example.com/a v1.0.0\n",
+			mods: map[string]string{
+				"example.com/a@v1.0.0": "module example.com/a\ngo 1.17\nrequire example.com/c v1.0.0\n",
+				"example.com/c@v1.0.0": "module example.com/c\ngo 1.17\nrequire example.com/d v1.0.0\n",
+			},
+			want: []Package{
+				{Name: "example.com/a", Version: "v1.0.0"},
+				{Name: "example.com/c", Version: "v1.0.0", Indirect: true},
+			},
+		},
+		{
+			name: "dependency before 1.17 is followed from a pruned main module",
+			main: "module example.com/main\ngo 1.21\nrequire example.com/a v1.0.0\n",
+			mods: map[string]string{
+				"example.com/a@v1.0.0": "module example.com/a\ngo 1.16\nrequire example.com/c v1.0.0\n",
+				"example.com/c@v1.0.0": "module example.com/c\ngo 1.16\nrequire example.com/d v1.0.0\n",
+				"example.com/d@v1.0.0": "module example.com/d\n",
+			},
+			want: []Package{
+				{Name: "example.com/a", Version: "v1.0.0"},
+				{Name: "example.com/c", Version: "v1.0.0", Indirect: true},
+				{Name: "example.com/d", Version: "v1.0.0", Indirect: true},
+			},
+		},
+		{
+			name: "prerelease go versions are pruned",
+			main: "module example.com/main\ngo 1.21rc1\nrequire example.com/a v1.0.0\n",
+			mods: map[string]string{
+				"example.com/a@v1.0.0": "module example.com/a\ngo 1.22rc2\nrequire example.com/c v1.0.0\n",
+				"example.com/c@v1.0.0": "module example.com/c\nrequire example.com/d v1.0.0\n",
+			},
+			want: []Package{
+				{Name: "example.com/a", Version: "v1.0.0"},
+				{Name: "example.com/c", Version: "v1.0.0", Indirect: true},
+			},
+		},
+		{
+			name: "excluded versions are neither selected nor followed",
+			main: "module example.com/main\ngo 1.16\nrequire (\n\texample.com/a v1.0.0\n\texample.com/b v1.0.0\n)\nexclude example.com/a v1.1.0\n",
+			mods: map[string]string{
+				"example.com/a@v1.0.0": "module example.com/a\n",
+				"example.com/a@v1.1.0": "module example.com/a\nrequire example.com/e v1.0.0\n",
+				"example.com/b@v1.0.0": "module example.com/b\nrequire example.com/a v1.1.0\n",
+				"example.com/e@v1.0.0": "module example.com/e\n",
+			},
+			want: []Package{
+				{Name: "example.com/a", Version: "v1.0.0"},
+				{Name: "example.com/b", Version: "v1.0.0"},
+			},
+		},
+		{
+			name: "replacements are followed and local directories are not",
+			main: "module example.com/main\ngo 1.16\nrequire (\n\texample.com/a v1.0.0\n\texample.com/b v1.0.0\n)\n" +
+				"replace example.com/a => example.com/fork v1.0.0\nreplace example.com/b => ../b\n",
+			mods: map[string]string{
+				"example.com/fork@v1.0.0": "module example.com/a\nrequire example.com/c v1.0.0\n",
+				"example.com/c@v1.0.0":    "module example.com/c\nrequire example.com/main v0.1.0\n",
+			},
+			want: []Package{
+				{Name: "example.com/a", Version: "v1.0.0"},
+				{Name: "example.com/b", Version: "v1.0.0"},
+				{Name: "example.com/c", Version: "v1.0.0", Indirect: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			main, err := ParseMod(strings.NewReader(tt.main))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := BuildList(context.Background(), main, writeModProxy(t, tt.mods))
+			if err != nil {
+				t.Fatalf("BuildList() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BuildList() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// PackageOptions control how the packages of a module are resolved.
+type PackageOptions struct {
+	GOOS   string   // target operating system, defaults to that of the go command
+	GOARCH string   // target architecture, defaults to that of the go command
+	Tags   []string // additional build tags
+	Tests  bool     // include the dependencies of the tests of the packages
+}
+
+// listedPackage is the part of the output of go list -json that we need.
+type listedPackage struct {
+	ImportPath string
+	Standard   bool
+	Module     *struct {
+		Path    string
+		Version string
+		Main    bool
+	}
+}
+
+// PackageModules resolves the import graph of the packages matching patterns, e.g. ./cmd/..., in the module
+// in dir, and returns the paths of the modules that provide at least one of the packages in the graph,
+// not including the main module or the standard library. This requires the go command, which is killed
+// if ctx is done.
+func PackageModules(ctx context.Context, dir string, patterns []string, opts PackageOptions) (map[string]bool, error) {
+	gocmd, err := exec.LookPath("go")
+	if err != nil {
+		return nil, fmt.Errorf("go is required to resolve packages: %v", err)
+	}
+	args := []string{"list", "-deps", "-json"}
+	if opts.Tests {
+		args = append(args, "-test")
+	}
+	if len(opts.Tags) > 0 {
+		args = append(args, "-tags", strings.Join(opts.Tags, ","))
+	}
+	args = append(args, "--")
+	args = append(args, patterns...)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, gocmd, args...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	if opts.GOOS != "" {
+		cmd.Env = append(cmd.Env, "GOOS="+opts.GOOS)
+	}
+	if opts.GOARCH != "" {
+		cmd.Env = append(cmd.Env, "GOARCH="+opts.GOARCH)
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("go %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+
+	modules := make(map[string]bool)
+	d := json.NewDecoder(&stdout)
+	for {
+		var p listedPackage
+		if err := d.Decode(&p); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to parse go list output: %v", err)
+		}
+		if p.Standard || p.Module == nil || p.Module.Main {
+			continue
+		}
+		modules[p.Module.Path] = true
+	}
+	return modules, nil
+}
@@ -0,0 +1,244 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/module"
+)
+
+const (
+	proxyDirect = "direct"
+	proxyOff    = "off"
+)
+
+var errProxyOff = fmt.Errorf("module lookup disabled by GOPROXY=off: %w", fs.ErrNotExist)
+
+// proxySpec is a single entry in a GOPROXY list.
+type proxySpec struct {
+	url string
+	// fallBackOnError is true if the entry was followed by a pipe, in which case the next entry is tried
+	// after any error. Otherwise, the next entry is tried only if this one does not have the module.
+	fallBackOnError bool
+}
+
+// parseProxyList parses a GOPROXY list, following the same rules as the go command:
+// entries are separated by commas or pipes, "direct" and "off" end the list,
+// and entries without a scheme are assumed to be https.
+func parseProxyList(list string) ([]proxySpec, error) {
+	var proxies []proxySpec
+	for list != "" {
+		var (
+			u               string
+			fallBackOnError bool
+		)
+		if i := strings.IndexAny(list, ",|"); i >= 0 {
+			u = list[:i]
+			fallBackOnError = list[i] == '|'
+			list = list[i+1:]
+		} else {
+			u = list
+			list = ""
+		}
+		u = strings.TrimSpace(u)
+		if u == "" {
+			continue
+		}
+		if u == proxyOff || u == proxyDirect {
+			// nothing after these is ever tried
+			proxies = append(proxies, proxySpec{url: u})
+			break
+		}
+		// single words are reserved for built-in behaviours, anything else without a scheme is https
+		if strings.ContainsAny(u, ".:/") && !strings.Contains(u, ":/") && !filepath.IsAbs(u) && !path.IsAbs(u) {
+			u = "https://" + u
+		}
+		parsed, err := url.Parse(u)
+		if err != nil {
+			// a URL that does not parse cannot be redacted, so leave it out, along with the url.Error quoting it
+			var uerr *url.Error
+			if errors.As(err, &uerr) {
+				err = uerr.Err
+			}
+			return nil, fmt.Errorf("invalid proxy URL: %v", err)
+		}
+		if parsed.Scheme != "http" && parsed.Scheme != "https" && parsed.Scheme != "file" {
+			return nil, fmt.Errorf("invalid proxy URL %s: unsupported scheme %q", redactURL(u), parsed.Scheme)
+		}
+		proxies = append(proxies, proxySpec{url: strings.TrimSuffix(u, "/"), fallBackOnError: fallBackOnError})
+	}
+	if len(proxies) == 0 {
+		return nil, fmt.Errorf("proxy list contains no entries")
+	}
+	return proxies, nil
+}
+
+// proxyListFor returns the GOPROXY list to use for the module. As with the go command, modules matching
+// GONOPROXY, or GOPRIVATE if it is not set, never go to a proxy, and are retrieved directly from version
+// control instead, unless the list is only "off".
+func proxyListFor(modPath, list string) string {
+	noProxy := goEnv("GONOPROXY")
+	if noProxy == "" {
+		noProxy = goEnv("GOPRIVATE")
+	}
+	if noProxy == "" || !module.MatchPrefixPatterns(noProxy, modPath) {
+		return list
+	}
+	if proxies, err := parseProxyList(list); err == nil && proxies[0].url == proxyOff {
+		return list
+	}
+	return proxyDirect
+}
+
+// tryProxies calls f for each entry in the GOPROXY list in turn, until one succeeds. As with the go command,
+// the next entry is tried only if the failed entry did not have the module, unless it was followed by a pipe.
+// If all fail, the most helpful error is returned: errors from direct first, then other proxy errors,
+// and finally errors that the module does not exist. Once ctx is done, no further entries are tried.
+func tryProxies(ctx context.Context, list string, f func(proxy string) error) error {
+	proxies, err := parseProxyList(list)
+	if err != nil {
+		return err
+	}
+	const (
+		notExistRank = iota
+		proxyRank
+		directRank
+	)
+	var (
+		bestErr     error
+		bestErrRank = notExistRank
+	)
+	for _, p := range proxies {
+		var err error
+		if p.url == proxyOff {
+			err = errProxyOff
+		} else {
+			err = f(p.url)
+		}
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		isNotExist := errors.Is(err, fs.ErrNotExist)
+		switch {
+		case p.url == proxyDirect:
+			bestErr, bestErrRank = err, directRank
+		case bestErrRank <= proxyRank && !isNotExist:
+			bestErr, bestErrRank = err, proxyRank
+		case bestErrRank == notExistRank:
+			bestErr = err
+		}
+		if !p.fallBackOnError && !isNotExist {
+			break
+		}
+	}
+	return bestErr
+}
+
+// proxyGet retrieves the given path from a single proxy. If the proxy does not have it,
+// the returned error wraps fs.ErrNotExist.
+func proxyGet(ctx context.Context, proxy, p string) ([]byte, error) {
+	if strings.HasPrefix(proxy, "file://") {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return nil, err
+		}
+		return os.ReadFile(filepath.Join(filepath.FromSlash(u.Path), filepath.FromSlash(p)))
+	}
+	u := fmt.Sprintf("%s/%s", proxy, p)
+	resp, body, err := httpGet(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if err := proxyStatus(u, resp); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// proxyDownload retrieves the given path from a single proxy as proxyGet does, but into f rather than memory.
+// It must be no larger than maxSize.
+func proxyDownload(ctx context.Context, proxy, p string, f *os.File, maxSize int64) error {
+	if strings.HasPrefix(proxy, "file://") {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return err
+		}
+		src, err := os.Open(filepath.Join(filepath.FromSlash(u.Path), filepath.FromSlash(p)))
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		if err := copyToFile(f, src, maxSize); err != nil {
+			return fmt.Errorf("failed to read %s: %w", src.Name(), err)
+		}
+		return nil
+	}
+	u := fmt.Sprintf("%s/%s", proxy, p)
+	resp, _, err := httpGetFile(ctx, u, f, maxSize)
+	if err != nil {
+		return err
+	}
+	return proxyStatus(u, resp)
+}
+
+// proxyStatus returns the error for a response from a proxy that is not successful. If the proxy does not have
+// the path, the error wraps fs.ErrNotExist.
+func proxyStatus(u string, resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound, http.StatusGone:
+		return fmt.Errorf("%s: %s: %w", redactURL(u), resp.Status, fs.ErrNotExist)
+	default:
+		return fmt.Errorf("%s: %s", redactURL(u), resp.Status)
+	}
+}
+
+// escapeModule returns the module path and version in the escaped form used by proxies and the module cache,
+// where each upper-case letter is replaced by an exclamation mark followed by the lower-case letter,
+// e.g. github.com/BurntSushi/toml becomes github.com/!burnt!sushi/toml. An empty version is left empty.
+func escapeModule(modPath, version string) (escPath, escVersion string, err error) {
+	escPath, err = module.EscapePath(modPath)
+	if err != nil {
+		return "", "", err
+	}
+	if version == "" {
+		return escPath, "", nil
+	}
+	escVersion, err = module.EscapeVersion(version)
+	if err != nil {
+		return "", "", err
+	}
+	return escPath, escVersion, nil
+}
+
+// DownloadURL returns the URL of the zip for the given module version on the first proxy in the GOPROXY list,
+// or an empty string if that proxy is not a URL, or the module is not retrieved from a proxy.
+// Any credentials in the proxy URL are left out.
+func DownloadURL(list, modPath, version string) string {
+	proxies, err := parseProxyList(proxyListFor(modPath, list))
+	if err != nil || proxies[0].url == proxyDirect || proxies[0].url == proxyOff {
+		return ""
+	}
+	escPath, escVersion, err := escapeModule(modPath, version)
+	if err != nil {
+		return ""
+	}
+	u, err := url.Parse(fmt.Sprintf("%s/%s/@v/%s.zip", proxies[0].url, escPath, escVersion))
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	return u.String()
+}
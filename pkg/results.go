@@ -0,0 +1,235 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const resultFileSuffix = ".json"
+
+// Result is what was found in a version of a module, which never changes once published, so need not be
+// retrieved and scanned again.
+type Result struct {
+	Module       string
+	Version      string
+	Hash         string            // h1: hash of the module contents
+	Licenses     []string          // licenses found in the module
+	LicenseFiles map[string]string // hex-encoded sha256 of each license file, keyed by its path in the zip
+	Zip          string            // absolute path of a zip of the module written from it, if any
+	Checksum     string            // hex-encoded sha256 of that zip
+}
+
+// CachedResult is a Result in the cache, with when it was last used.
+type CachedResult struct {
+	Result
+	Used time.Time
+}
+
+// ResultCache is an on-disk cache of Results, with a file for each module@version. A result is only ever
+// found for the same h1: hash, so that it cannot stand in for module contents that were not verified.
+type ResultCache struct {
+	dir string
+}
+
+// DefaultResultCacheDir returns the directory for the result cache in the user cache directory.
+func DefaultResultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "go-sources-and-licenses"), nil
+}
+
+// NewResultCache creates a ResultCache in dir, which is created when the first result is stored.
+func NewResultCache(dir string) *ResultCache {
+	return &ResultCache{dir: dir}
+}
+
+// Dir returns the directory holding the cache.
+func (c *ResultCache) Dir() string {
+	return c.dir
+}
+
+// resultPath returns the file for module@version, escaped as in the module cache.
+func (c *ResultCache) resultPath(modPath, version string) (string, error) {
+	escPath, escVersion, err := escapeModule(modPath, version)
+	if err != nil {
+		return "", fmt.Errorf("invalid module %s@%s: %v", modPath, version, err)
+	}
+	return filepath.Join(c.dir, filepath.FromSlash(escPath), "@v", escVersion+resultFileSuffix), nil
+}
+
+// Get returns the result for module@version, if there is one for the given hash, marking it as used.
+func (c *ResultCache) Get(modPath, version, hash string) (*Result, bool) {
+	p, err := c.resultPath(modPath, version)
+	if err != nil {
+		return nil, false
+	}
+	r, err := readResult(p)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Warnf("ignoring invalid cached result %s: %v", p, err)
+		}
+		return nil, false
+	}
+	if r.Module != modPath || r.Version != version || r.Hash != hash {
+		return nil, false
+	}
+	now := time.Now()
+	_ = os.Chtimes(p, now, now)
+	return r, true
+}
+
+// Put stores the result, replacing any for the same module@version.
+func (c *ResultCache) Put(r Result) error {
+	p, err := c.resultPath(r.Module, r.Version)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %v", err)
+	}
+	// written in full before it replaces the old, so that another run never reads half a result
+	tmp, err := os.CreateTemp(filepath.Dir(p), "."+filepath.Base(p)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create cached result: %v", err)
+	}
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cached result: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cached result: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cached result: %v", err)
+	}
+	return nil
+}
+
+// List returns every result in the cache, in order of module path and version.
+func (c *ResultCache) List() ([]CachedResult, error) {
+	var results []CachedResult
+	err := c.walk(func(p string, fi fs.FileInfo) error {
+		r, err := readResult(p)
+		if err != nil {
+			log.Warnf("ignoring invalid cached result %s: %v", p, err)
+			return nil
+		}
+		results = append(results, CachedResult{Result: *r, Used: fi.ModTime()})
+		return nil
+	})
+	return results, err
+}
+
+// Prune removes the results that were last used before the given time, returning how many were removed.
+func (c *ResultCache) Prune(before time.Time) (int, error) {
+	var removed int
+	err := c.walk(func(p string, fi fs.FileInfo) error {
+		if !fi.ModTime().Before(before) {
+			return nil
+		}
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		return removed, err
+	}
+	return removed, c.removeEmptyDirs()
+}
+
+// Clear removes every result from the cache. Only result files are removed, along with the directories left empty,
+// so anything else in the cache directory is kept, in case it was given as one used for other things too.
+func (c *ResultCache) Clear() error {
+	if err := c.walk(func(p string, _ fs.FileInfo) error {
+		return os.Remove(p)
+	}); err != nil {
+		return err
+	}
+	return c.removeEmptyDirs()
+}
+
+// removeEmptyDirs removes the directories under the cache directory that are empty, deepest first, so that
+// one only holding empty directories is removed too. The cache directory itself is kept.
+func (c *ResultCache) removeEmptyDirs() error {
+	var dirs []string
+	err := filepath.WalkDir(c.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && p != c.dir {
+			dirs = append(dirs, p)
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		entries, err := os.ReadDir(dirs[i])
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			continue
+		}
+		if err := os.Remove(dirs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walk calls f with each result file in the cache. A cache that does not exist yet is empty.
+func (c *ResultCache) walk(f func(p string, fi fs.FileInfo) error) error {
+	err := filepath.WalkDir(c.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, resultFileSuffix) || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return f(p, fi)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func readResult(p string) (*Result, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var r Result
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
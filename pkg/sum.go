@@ -33,6 +33,7 @@ func ParseSum(r io.Reader) (pkgs []Package) {
 		pkgs = append(pkgs, Package{
 			Name:    parts[0],
 			Version: parts[1],
+			Hash:    parts[2],
 		})
 	}
 	return
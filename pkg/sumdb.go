@@ -0,0 +1,171 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/mod/sumdb"
+)
+
+// DefaultSumDBKey is the verifier key for sum.golang.org.
+const DefaultSumDBKey = "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8"
+
+// ErrNoSumDB is returned by SumDB.Hash for modules that are not to be checked against the checksum database,
+// because they match GONOSUMDB or GOPRIVATE.
+var ErrNoSumDB = sumdb.ErrGONOSUMDB
+
+// SumDB looks up module hashes in a go checksum database, verifying every lookup against
+// the signed tree head and tiles of the database.
+type SumDB struct {
+	client *sumdb.Client
+}
+
+// NewSumDB creates a SumDB that reads the checksum database at location, which is either an http(s) URL,
+// or a local directory, possibly as a file:// URL, with the same layout as the database server, i.e. with
+// lookup/ and tile/ directories. key is the verifier key for the database; if empty,
+// the key from GOSUMDB is used, and then the key for sum.golang.org.
+// Modules matching GONOSUMDB, or GOPRIVATE if it is not set, are never looked up.
+// Lookups over the network are abandoned once ctx is done.
+func NewSumDB(ctx context.Context, location, key string) (*SumDB, error) {
+	if key == "" {
+		key = sumDBKey()
+	}
+	ops := &sumDBOps{
+		ctx:    ctx,
+		key:    []byte(key),
+		config: make(map[string][]byte),
+		cache:  make(map[string][]byte),
+	}
+	switch {
+	case strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://"):
+		ops.url = strings.TrimSuffix(location, "/")
+	case strings.HasPrefix(location, "file://"):
+		u, err := url.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid checksum database location %s: %v", location, err)
+		}
+		ops.dir = filepath.FromSlash(u.Path)
+	default:
+		ops.dir = location
+	}
+	if ops.dir != "" {
+		if fi, err := os.Stat(ops.dir); err != nil || !fi.IsDir() {
+			return nil, fmt.Errorf("checksum database location %s is not a directory", location)
+		}
+	}
+
+	client := sumdb.NewClient(ops)
+	noSumDB := goEnv("GONOSUMDB")
+	if noSumDB == "" {
+		noSumDB = goEnv("GOPRIVATE")
+	}
+	if noSumDB != "" {
+		client.SetGONOSUMDB(noSumDB)
+	}
+	return &SumDB{client: client}, nil
+}
+
+// sumDBKey returns the verifier key from GOSUMDB, which is of the form "name+key [url]",
+// or the key for sum.golang.org if it is not set or only names sum.golang.org.
+func sumDBKey() string {
+	fields := strings.Fields(goEnv("GOSUMDB"))
+	if len(fields) == 0 || !strings.Contains(fields[0], "+") {
+		return DefaultSumDBKey
+	}
+	return fields[0]
+}
+
+// Hash returns the h1: hash of the module zip recorded in the checksum database.
+// If the module is not to be checked against the database, the error is ErrNoSumDB.
+func (s *SumDB) Hash(modPath, version string) (string, error) {
+	lines, err := s.client.Lookup(modPath, version)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range lines {
+		if fields := strings.Fields(line); len(fields) == 3 && fields[0] == modPath && fields[1] == version {
+			return fields[2], nil
+		}
+	}
+	return "", fmt.Errorf("no hash for %s@%s in checksum database", modPath, version)
+}
+
+// sumDBOps provides the sumdb client with access to the database, and keeps its configuration
+// and cache in memory. The client has no way to pass a context to each read, so ops holds the one
+// for all of them.
+type sumDBOps struct {
+	ctx context.Context
+	url string
+	dir string
+	key []byte
+
+	mu     sync.Mutex
+	config map[string][]byte
+	cache  map[string][]byte
+}
+
+func (o *sumDBOps) ReadRemote(p string) ([]byte, error) {
+	if o.dir != "" {
+		return os.ReadFile(filepath.Join(o.dir, filepath.FromSlash(p)))
+	}
+	resp, body, err := httpGet(o.ctx, o.url+p)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", redactURL(o.url+p), resp.Status)
+	}
+	return body, nil
+}
+
+func (o *sumDBOps) ReadConfig(file string) ([]byte, error) {
+	if file == "key" {
+		return o.key, nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// no config is an empty, but valid, starting point
+	return o.config[file], nil
+}
+
+func (o *sumDBOps) WriteConfig(file string, old, new []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !bytes.Equal(o.config[file], old) {
+		return sumdb.ErrWriteConflict
+	}
+	o.config[file] = new
+	return nil
+}
+
+func (o *sumDBOps) ReadCache(file string) ([]byte, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if b, ok := o.cache[file]; ok {
+		return b, nil
+	}
+	return nil, errors.New("not cached")
+}
+
+func (o *sumDBOps) WriteCache(file string, data []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.cache[file] = data
+}
+
+func (o *sumDBOps) Log(msg string) {
+	log.Debug(msg)
+}
+
+func (o *sumDBOps) SecurityError(msg string) {
+	log.Error(msg)
+}
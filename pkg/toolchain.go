@@ -0,0 +1,119 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/mod/semver"
+)
+
+const (
+	// StdlibModule is the name used for the go standard library and runtime, which are linked into every binary.
+	StdlibModule = "stdlib"
+	// GoLicense is the license of the go distribution.
+	GoLicense = "BSD-3-Clause"
+
+	toolchainModule = "golang.org/toolchain"
+	// the first go version published as the toolchain module
+	toolchainModuleSince = "v1.21"
+	// the source of the distribution is the same for every platform, so any will do
+	toolchainPlatform = "linux-amd64"
+)
+
+// toolchainSourceFiles are the files and directories of a go distribution that make up its source.
+var toolchainSourceFiles = map[string]bool{
+	"LICENSE": true,
+	"PATENTS": true,
+	"VERSION": true,
+	"src":     true,
+}
+
+// ToolchainVersion returns the version of the go toolchain, e.g. go1.21.5, as recorded in a binary, where it may
+// be followed by the experiments enabled, e.g. "go1.21.5 X:boringcrypto". Development versions of go have no
+// released source, so return an empty string.
+func ToolchainVersion(recorded string) string {
+	fields := strings.Fields(recorded)
+	if len(fields) == 0 || fields[0] == "devel" || !strings.HasPrefix(fields[0], "go1") {
+		return ""
+	}
+	return fields[0]
+}
+
+// ToolchainDownloadURL returns the URL of the source archive of the given version of go, e.g. go1.21.5.
+func ToolchainDownloadURL(goVersion string) string {
+	return fmt.Sprintf("https://go.dev/dl/%s.src.tar.gz", goVersion)
+}
+
+// GetToolchainSource retrieves the source of the given version of go, e.g. go1.21.5, including its license.
+// It comes from the local GOROOT if that is the same version, else from the golang.org/toolchain module
+// on the proxy. The returned fs.FS is an io.Closer, to be closed once done with, as with GetModule.
+func GetToolchainSource(ctx context.Context, goVersion, proxy string) (fs.FS, error) {
+	if goroot := localGOROOT(ctx); goroot != "" && gorootVersion(goroot) == goVersion {
+		log.Debugf("found go %s source locally at %s", goVersion, goroot)
+		return &filteredFS{FS: os.DirFS(goroot), hide: hideNonSource}, nil
+	}
+	if semver.Compare(langVersion(strings.TrimPrefix(goVersion, "go")), toolchainModuleSince) < 0 {
+		return nil, fmt.Errorf("%s has no versions before go %s, and the local GOROOT is not go %s",
+			toolchainModule, strings.TrimPrefix(toolchainModuleSince, "v"), strings.TrimPrefix(goVersion, "go"))
+	}
+	version := fmt.Sprintf("v0.0.1-%s.%s", goVersion, toolchainPlatform)
+	fsys, err := GetModule(ctx, toolchainModule, version, proxy, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get go %s: %w", goVersion, err)
+	}
+	// the distribution is under module@version in the module zip
+	root := fmt.Sprintf("%s@%s", toolchainModule, version)
+	if _, ok := ZipReader(fsys); !ok {
+		root = "."
+	}
+	sub, err := fs.Sub(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+	closer, _ := fsys.(io.Closer)
+	return &filteredFS{FS: sub, hide: hideNonSource, closer: closer}, nil
+}
+
+// hideNonSource hides everything at the top level of a go distribution other than its source.
+func hideNonSource(name string) bool {
+	return !strings.Contains(name, "/") && !toolchainSourceFiles[name]
+}
+
+// localGOROOT returns the GOROOT of the local go installation, if any. Asking the go command for it is
+// abandoned once ctx is done.
+func localGOROOT(ctx context.Context) string {
+	if goroot := goEnv("GOROOT"); goroot != "" {
+		return goroot
+	}
+	gocmd, err := exec.LookPath("go")
+	if err != nil {
+		return ""
+	}
+	out, err := exec.CommandContext(ctx, gocmd, "env", "GOROOT").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// gorootVersion returns the version of the go distribution in goroot, from the first line of its VERSION file.
+func gorootVersion(goroot string) string {
+	b, err := os.ReadFile(filepath.Join(goroot, "VERSION"))
+	if err != nil {
+		return ""
+	}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	if !sc.Scan() {
+		return ""
+	}
+	return strings.TrimSpace(sc.Text())
+}
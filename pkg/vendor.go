@@ -0,0 +1,107 @@
+package pkg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+const (
+	VendorDir  = "vendor"
+	ModulesTxt = "modules.txt"
+)
+
+// VendoredModule is a module whose packages were copied into the vendor directory, as listed in vendor/modules.txt.
+type VendoredModule struct {
+	Package
+	Replace   *Package // the replacement of the module, if it was replaced; a local directory has no version
+	Explicit  bool     // whether the module is required by the go.mod of the main module
+	GoVersion string   // go version of the module, if known
+	Packages  []string // import paths of the packages of the module that were vendored
+}
+
+// ParseVendor parses vendor/modules.txt, as written by go mod vendor.
+func ParseVendor(r io.Reader) ([]VendoredModule, error) {
+	var (
+		mods []VendoredModule
+		cur  *VendoredModule
+		n    int
+	)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		n++
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "## "):
+			if cur == nil {
+				return nil, fmt.Errorf("invalid %s:%d: annotation before any module", ModulesTxt, n)
+			}
+			for _, a := range strings.Split(strings.TrimPrefix(line, "## "), ";") {
+				a = strings.TrimSpace(a)
+				switch {
+				case a == "explicit":
+					cur.Explicit = true
+				case strings.HasPrefix(a, "go "):
+					cur.GoVersion = strings.TrimPrefix(a, "go ")
+				}
+			}
+		case strings.HasPrefix(line, "# "):
+			fields := strings.Fields(strings.TrimPrefix(line, "# "))
+			var m VendoredModule
+			old, replace := fields, []string(nil)
+			for i, f := range fields {
+				if f == "=>" {
+					old, replace = fields[:i], fields[i+1:]
+					break
+				}
+			}
+			if len(old) < 1 || len(old) > 2 || (replace != nil && (len(replace) < 1 || len(replace) > 2)) {
+				return nil, fmt.Errorf("invalid %s:%d: malformed module line", ModulesTxt, n)
+			}
+			m.Name = old[0]
+			if len(old) == 2 {
+				m.Version = old[1]
+			}
+			if replace != nil {
+				m.Replace = &Package{Name: replace[0]}
+				if len(replace) == 2 {
+					m.Replace.Version = replace[1]
+				}
+			}
+			mods = append(mods, m)
+			cur = &mods[len(mods)-1]
+		case strings.HasPrefix(line, "#"):
+			return nil, fmt.Errorf("invalid %s:%d: unknown line %q", ModulesTxt, n, line)
+		default:
+			if cur == nil {
+				return nil, fmt.Errorf("invalid %s:%d: package %s before any module", ModulesTxt, n, line)
+			}
+			cur.Packages = append(cur.Packages, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", ModulesTxt, err)
+	}
+	return mods, nil
+}
+
+// VendoredModuleFS returns the files of the vendored module modPath, given fsys, the vendor directory, and mods,
+// every module in it. Modules whose paths are nested within modPath are vendored within its directory,
+// so their directories are left out.
+func VendoredModuleFS(fsys fs.FS, modPath string, mods []VendoredModule) (fs.FS, error) {
+	sub, err := fs.Sub(fsys, modPath)
+	if err != nil {
+		return nil, err
+	}
+	hidden := make(map[string]bool)
+	for _, m := range mods {
+		if strings.HasPrefix(m.Name, modPath+"/") {
+			hidden[strings.TrimPrefix(m.Name, modPath+"/")] = true
+		}
+	}
+	return &filteredFS{FS: sub, hide: func(name string) bool { return hidden[name] }}, nil
+}
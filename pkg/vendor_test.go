@@ -0,0 +1,102 @@
+package pkg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseVendor(t *testing.T) {
+	tests := []struct {
+		name    string
+		txt     string
+		want    []VendoredModule
+		wantErr bool
+	}{
+		{
+			name: "modules and packages",
+			txt: `# github.com/a/b v1.2.3
+## explicit; go 1.20
+github.com/a/b
+github.com/a/b/c
+# golang.org/x/sys v0.1.0
+golang.org/x/sys/unix
+`,
+			want: []VendoredModule{
+				{Package: Package{Name: "github.com/a/b", Version: "v1.2.3"}, Explicit: true, GoVersion: "1.20", Packages: []string{"github.com/a/b", "github.com/a/b/c"}},
+				{Package: Package{Name: "golang.org/x/sys", Version: "v0.1.0"}, Packages: []string{"golang.org/x/sys/unix"}},
+			},
+		},
+		{
+			name: "replaced by a module",
+			txt: `# github.com/a/b v1.2.3 => github.com/fork/b v1.2.4
+## explicit
+github.com/a/b
+`,
+			want: []VendoredModule{
+				{Package: Package{Name: "github.com/a/b", Version: "v1.2.3"}, Replace: &Package{Name: "github.com/fork/b", Version: "v1.2.4"}, Explicit: true, Packages: []string{"github.com/a/b"}},
+			},
+		},
+		{
+			name: "replaced by a local directory",
+			txt: `# github.com/a/b v1.2.3 => ../b
+## explicit; go 1.21
+github.com/a/b
+# github.com/a/b => ../b
+`,
+			want: []VendoredModule{
+				{Package: Package{Name: "github.com/a/b", Version: "v1.2.3"}, Replace: &Package{Name: "../b"}, Explicit: true, GoVersion: "1.21", Packages: []string{"github.com/a/b"}},
+				{Package: Package{Name: "github.com/a/b"}, Replace: &Package{Name: "../b"}},
+			},
+		},
+		{
+			name: "required without packages",
+			txt: `# github.com/a/b v1.2.3
+## explicit
+`,
+			want: []VendoredModule{
+				{Package: Package{Name: "github.com/a/b", Version: "v1.2.3"}, Explicit: true},
+			},
+		},
+		{
+			name: "empty",
+			txt:  "",
+		},
+		{
+			name:    "package before any module",
+			txt:     "github.com/a/b\n",
+			wantErr: true,
+		},
+		{
+			name:    "annotation before any module",
+			txt:     "## explicit\n",
+			wantErr: true,
+		},
+		{
+			name:    "replacement without a target",
+			txt:     "# github.com/a/b v1.2.3 =>\n",
+			wantErr: true,
+		},
+		{
+			name:    "too many fields",
+			txt:     "# github.com/a/b v1.2.3 extra\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown line",
+			txt:     "#github.com/a/b v1.2.3\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseVendor(strings.NewReader(tt.txt))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseVendor() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseVendor() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
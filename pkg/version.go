@@ -0,0 +1,133 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// LatestVersion resolves the latest version of the module, the same way as the go command resolves @latest.
+// The proxy's @latest is asked first, as it has already applied the go command's rules. If no proxy in the
+// list can answer it, such as for direct or a file:// proxy, the version list is used instead: the highest
+// release version is preferred over the highest pre-release, ignoring any versions retracted by the go.mod
+// of the latest version.
+func LatestVersion(ctx context.Context, modPath, proxy string) (string, error) {
+	latest, latestErr := proxyLatest(ctx, modPath, proxy)
+	if latestErr == nil {
+		return latest, nil
+	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	log.Debugf("could not get @latest of %s, resolving it from the version list: %v", modPath, latestErr)
+
+	versions, err := GetVersions(ctx, modPath, proxy)
+	if err != nil {
+		return "", fmt.Errorf("failed to get versions of %s: %v", modPath, err)
+	}
+	var valid []string
+	for _, v := range versions {
+		if semver.IsValid(v) && !module.IsPseudoVersion(v) {
+			valid = append(valid, v)
+		}
+	}
+	semver.Sort(valid)
+
+	latest = preferredVersion(valid)
+	if latest == "" {
+		return "", fmt.Errorf("no versions found for %s: %v", modPath, latestErr)
+	}
+	// only the latest go.mod is authoritative for retractions
+	var latestMod *ModFile
+	b, err := GetModFile(ctx, modPath, latest, proxy)
+	if err != nil {
+		log.Warnf("failed to get go.mod for %s@%s to check retractions: %v", modPath, latest, err)
+	} else if latestMod, err = ParseModLax(bytes.NewReader(b)); err != nil {
+		log.Warnf("failed to parse go.mod for %s@%s to check retractions: %v", modPath, latest, err)
+		latestMod = nil
+	}
+	var allowed []string
+	for _, v := range valid {
+		if latestMod != nil && latestMod.Retracted(v) {
+			log.Debugf("ignoring retracted version %s@%s", modPath, v)
+			continue
+		}
+		allowed = append(allowed, v)
+	}
+	if latest := preferredVersion(allowed); latest != "" {
+		return latest, nil
+	}
+	return "", fmt.Errorf("all versions of %s are retracted, and could not get @latest: %v", modPath, latestErr)
+}
+
+// preferredVersion returns the highest release version in a sorted list of versions, or if there are none,
+// the highest pre-release version.
+func preferredVersion(sorted []string) string {
+	for i := len(sorted) - 1; i >= 0; i-- {
+		if semver.Prerelease(sorted[i]) == "" {
+			return sorted[i]
+		}
+	}
+	if len(sorted) > 0 {
+		return sorted[len(sorted)-1]
+	}
+	return ""
+}
+
+// proxyLatest asks the proxies in the GOPROXY list for the @latest version of the module.
+func proxyLatest(ctx context.Context, modPath, proxy string) (string, error) {
+	escPath, _, err := escapeModule(modPath, "")
+	if err != nil {
+		return "", fmt.Errorf("invalid module %s: %v", modPath, err)
+	}
+	var version string
+	err = tryProxies(ctx, proxyListFor(modPath, proxy), func(p string) error {
+		if p == proxyDirect {
+			return fmt.Errorf("no tagged versions of %s in its repository: %w", modPath, fs.ErrNotExist)
+		}
+		b, err := proxyGet(ctx, p, fmt.Sprintf("%s/@latest", escPath))
+		if err != nil {
+			return err
+		}
+		var info struct {
+			Version string
+		}
+		if err := json.Unmarshal(b, &info); err != nil {
+			return fmt.Errorf("invalid @latest response from %s: %v", redactURL(p), err)
+		}
+		if !semver.IsValid(info.Version) {
+			return fmt.Errorf("invalid @latest version %q from %s", info.Version, redactURL(p))
+		}
+		version = info.Version
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+// PseudoVersion returns the pseudo-version of modPath at the given VCS revision, committed at vcsTime in RFC3339
+// format, as recorded in a binary built from a checkout. The revision is shortened to 12 characters, as the go
+// command does. As the preceding tag is unknown, it is based on v0.0.0 at the major version of modPath.
+func PseudoVersion(modPath, revision, vcsTime string) (string, error) {
+	if revision == "" || vcsTime == "" {
+		return "", fmt.Errorf("need both a revision and a time for a pseudo-version")
+	}
+	t, err := time.Parse(time.RFC3339, vcsTime)
+	if err != nil {
+		return "", fmt.Errorf("invalid revision time %s: %v", vcsTime, err)
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	_, pathMajor, _ := module.SplitPathVersion(modPath)
+	return module.PseudoVersion(module.PathMajorPrefix(pathMajor), "", t, revision), nil
+}
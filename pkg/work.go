@@ -0,0 +1,82 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/mod/modfile"
+)
+
+const workFile = "go.work"
+
+// WorkFile is a parsed go.work file, describing a workspace of modules that are built together.
+type WorkFile struct {
+	GoVersion   string
+	GoToolchain string
+	Godebug     map[string]string
+	Uses        []string // directories of the workspace modules, relative to the go.work
+	Replace     map[string]Package
+}
+
+// ParseWork parses a go.work file. Errors include the line on which they occur.
+func ParseWork(r io.Reader) (*WorkFile, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", workFile, err)
+	}
+	f, err := modfile.ParseWork(workFile, b, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", workFile, err)
+	}
+	w := WorkFile{
+		Godebug: map[string]string{},
+		Replace: map[string]Package{},
+	}
+	if f.Go != nil {
+		w.GoVersion = f.Go.Version
+	}
+	if f.Toolchain != nil {
+		w.GoToolchain = f.Toolchain.Name
+	}
+	for _, g := range f.Godebug {
+		w.Godebug[g.Key] = g.Value
+	}
+	for _, u := range f.Use {
+		w.Uses = append(w.Uses, u.Path)
+	}
+	for _, r := range f.Replace {
+		old := Package{Name: r.Old.Path, Version: r.Old.Version}
+		w.Replace[old.String()] = Package{Name: r.New.Path, Version: r.New.Version}
+	}
+	return &w, nil
+}
+
+// FindWorkFile returns the path to the go.work file for the module in dir, as the go command finds it:
+// GOWORK if it is set, else the first go.work in dir or any of its parents. If GOWORK is "off",
+// or there is no go.work, it returns an empty string.
+func FindWorkFile(dir string) (string, error) {
+	switch env := goEnv("GOWORK"); env {
+	case "off":
+		return "", nil
+	case "":
+	default:
+		return env, nil
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		p := filepath.Join(dir, workFile)
+		if fi, err := os.Stat(p); err == nil && fi.Mode().IsRegular() {
+			return p, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
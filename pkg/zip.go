@@ -4,30 +4,68 @@ import (
 	"archive/zip"
 	"io"
 	"io/fs"
+	"os"
 	"strings"
 )
 
+// moduleZip is a module zip retrieved into a temporary file, which is removed when it is closed.
+type moduleZip struct {
+	*zip.ReadCloser
+	temp string
+}
+
+func (z *moduleZip) Close() error {
+	err := z.ReadCloser.Close()
+	if rmErr := os.Remove(z.temp); err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// ZipReader returns the zip holding fsys, if it is a module zip, whether it is read from memory or a file.
+func ZipReader(fsys fs.FS) (*zip.Reader, bool) {
+	switch z := fsys.(type) {
+	case *zip.Reader:
+		return z, true
+	case *zip.ReadCloser:
+		return &z.Reader, true
+	case *moduleZip:
+		return &z.Reader, true
+	}
+	return nil, false
+}
+
 func WriteToZip(fsys fs.FS, zw *zip.Writer) ([]string, error) {
+	licenses, _, err := WriteToZipWithLicenseFiles(fsys, zw)
+	return licenses, err
+}
+
+// WriteToZipWithLicenseFiles writes fsys to the zip as WriteToZip does, also returning the hex-encoded sha256 of
+// each license file found, keyed by its path in the zip.
+func WriteToZipWithLicenseFiles(fsys fs.FS, zw *zip.Writer) ([]string, map[string]string, error) {
 	licenseListers, err := writeToZip(fsys, zw)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	var licenses []string
+	files := make(map[string]string)
 	for _, r := range licenseListers {
 		if l, ok := r.(*licenseReader); ok {
 			licenses = append(licenses, l.licenses...)
+			files[l.path] = l.sum
 		}
 	}
-	return licenses, nil
-
+	return licenses, files, nil
 }
 func writeToZip(fsys fs.FS, zw *zip.Writer) ([]io.ReadCloser, error) {
 	var licenseListers []io.ReadCloser
 	// is our fs a zip reader in the first place?
-	if tr, ok := fsys.(*zip.Reader); ok {
+	if tr, ok := ZipReader(fsys); ok {
 		// just copy it all over
 		for _, f := range tr.File {
-			w, err := zw.CreateHeader(&f.FileHeader)
+			// the writer modifies the header it is given, which would break later reads of the source
+			hdr := f.FileHeader
+			w, err := zw.CreateHeader(&hdr)
 			if err != nil {
 				return nil, err
 			}